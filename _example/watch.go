@@ -9,36 +9,35 @@ import (
 )
 
 func main() {
-	ch := clipboard.Watch(context.TODO())
+	ch := clipboard.Events(context.TODO())
 	fmt.Println("Start watch the clipboard...")
-	for data := range ch {
-		fmt.Println(data.Type)
-		// types := clipboard.GetContentTypes()
-		// fmt.Println(types)
-
-		if data.Type == "public.utf8-plain-text" {
-			if text, ok := data.Data.(string); ok {
-				fmt.Println(text)
-			}
-		}
-		if data.Type == "public.html" {
-			if text, ok := data.Data.(string); ok {
-				fmt.Println(text)
+	for e := range ch {
+		fmt.Println(e.Seq, e.Formats)
+		switch {
+		case e.Has(clipboard.TypeFiles):
+			files, err := e.Files()
+			if err == nil {
+				for _, f := range files {
+					fmt.Println(f)
+				}
 			}
-		}
-		if data.Type == "public.png" {
-			if f, ok := data.Data.([]byte); ok {
-				img_filepath, err := util.SaveByteAsLocalImage(f)
+		case e.Has(clipboard.TypePNG):
+			data, err := e.Image()
+			if err == nil {
+				img_filepath, err := util.SaveByteAsLocalImage(data)
 				if err == nil {
 					fmt.Println("the image save to", img_filepath)
 				}
 			}
-		}
-		if data.Type == "public.file-url" {
-			if files, ok := data.Data.([]string); ok {
-				for _, f := range files {
-					fmt.Println(f)
-				}
+		case e.Has(clipboard.TypeHTML):
+			html, err := e.HTML()
+			if err == nil {
+				fmt.Println(html)
+			}
+		case e.Has(clipboard.TypeText):
+			text, err := e.Text()
+			if err == nil {
+				fmt.Println(text)
 			}
 		}
 	}
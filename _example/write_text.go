@@ -12,19 +12,13 @@ func main() {
 		fmt.Printf("初始化剪贴板失败: %v\n", err)
 		return
 	}
-	err = clipboard.WriteText("Test content")
+	owned, err := clipboard.WriteTextOwned("Test content")
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		return
 	}
 	fmt.Println("写入成功")
-	// 默认就能写入成功？
-	// if changed != nil {
-	// 	<-r
-	// 	fmt.Printf("写入成功")
-	// }
-	// select {
-	// case <-changed:
-	// 	println(`"text data" is no longer available from clipboard.`)
-	// }
+	// 在 Linux 上内容由本进程提供，等到被其他内容覆盖再退出
+	<-owned.Done()
+	fmt.Println("剪贴板内容已被覆盖")
 }
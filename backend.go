@@ -0,0 +1,145 @@
+package clipboard
+
+import "context"
+
+// Backend is the implementation behind a Clipboard. The default
+// Clipboard uses the native clipboard of the running system unless
+// another backend is installed with Use, for example the in-memory one
+// from the clipboardtest package. Backends must be safe for concurrent
+// use.
+//
+// Types returned by ContentTypes and used in ClipboardContent and
+// Representation are TypeText, TypeHTML, TypePNG and TypeFiles, plus
+// whatever else the backend knows about.
+type Backend interface {
+	ReadText() (string, error)
+	ReadHTML() (string, error)
+	// ReadImage returns PNG encoded image data.
+	ReadImage() ([]byte, error)
+	ReadFiles() ([]string, error)
+	WriteText(text string) error
+	WriteHTML(html string) error
+	// WriteImage writes PNG encoded image data.
+	WriteImage(data []byte) error
+	WriteFiles(files []string) error
+	// ReadFormat returns the content as type name, which may be any
+	// type of the system: UTI, MIME type, X11 atom or Windows clipboard
+	// format name.
+	ReadFormat(name string) ([]byte, error)
+	// ReadAll returns the content in every type it is available as,
+	// ErrEmpty when there is none.
+	ReadAll() ([]Representation, error)
+	// WriteAll replaces the content with items in a single change.
+	WriteAll(items ...Representation) error
+	// ContentTypes lists the types currently on the clipboard.
+	ContentTypes() []string
+	// ChangeCount increases whenever the clipboard content changes.
+	ChangeCount() uint64
+	// Subscribe returns a channel signalled after changes of the
+	// content, and a function to call once done with it. Backends
+	// without change notification return a nil channel, they are polled
+	// with ChangeCount.
+	Subscribe() (<-chan struct{}, func())
+}
+
+// Use installs b as the backend of the default Clipboard, which
+// lets code depending on this package be tested without a desktop:
+//
+//	fake := clipboardtest.New()
+//	clipboard.Use(fake)
+//	defer clipboard.Use(nil)
+//
+// Use(nil) restores the native clipboard.
+func Use(b Backend) {
+	if b == nil {
+		b = native_backend{}
+	}
+	std.set_backend(b)
+}
+
+// native_backend forwards to the per OS implementation, holding the
+// global lock as some systems do not support concurrent access.
+type native_backend struct{}
+
+func (native_backend) ReadText() (string, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	return read_text()
+}
+func (native_backend) ReadHTML() (string, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	return read_html()
+}
+func (native_backend) ReadImage() ([]byte, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	return read_image()
+}
+func (native_backend) ReadFiles() ([]string, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	return read_files()
+}
+func (native_backend) WriteText(text string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	return write_text(text)
+}
+func (native_backend) WriteHTML(html string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	return write_html(html)
+}
+func (native_backend) WriteImage(data []byte) error {
+	lock.Lock()
+	defer lock.Unlock()
+	return write_image(data)
+}
+func (native_backend) WriteFiles(files []string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	return write_files(files)
+}
+func (native_backend) ReadFormat(name string) ([]byte, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	return read_format(name)
+}
+func (native_backend) ReadAll() ([]Representation, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	return read_all()
+}
+func (native_backend) WriteAll(items ...Representation) error {
+	lock.Lock()
+	defer lock.Unlock()
+	return write_all(items)
+}
+func (native_backend) ChangeCount() uint64 {
+	return uint64(get_change_count())
+}
+
+func (native_backend) ContentTypes() []string {
+	lock.Lock()
+	defer lock.Unlock()
+	types, err := get_content_types(ContentTypeParams{IsEnabled: false})
+	if err != nil {
+		native_log().Warn("failed to list the clipboard formats", "error", err)
+	}
+	return types
+}
+
+func (native_backend) Subscribe() (<-chan struct{}, func()) {
+	return subscribe()
+}
+
+func (native_backend) lost(seq uint64) <-chan struct{} {
+	return ownership_lost(seq)
+}
+
+// with_context binds the operations to ctx where the system makes them
+// wait for other applications.
+func (native_backend) with_context(ctx context.Context) Backend {
+	return native_context(ctx)
+}
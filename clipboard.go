@@ -4,30 +4,63 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
+	"strings"
 	"sync"
-)
+	"time"
 
-var (
-	err_unavailable = errors.New("clipboard unavailable")
-	err_unsupported = errors.New("unsupported format")
+	"github.com/ltaoo/clipboard-go/pkg/format"
 )
 
+var err_unsupported = errors.New("unsupported format")
+
 // Format represents the format of clipboard data.
 type Format int
 
-// All sorts of supported clipboard data
+// All sorts of supported clipboard data, Read and Write exchange them
+// encoded as described here.
 const (
-	// FmtText indicates plain text clipboard format
+	// FmtText indicates plain text clipboard format, UTF-8 encoded
 	FmtText Format = iota
 	// FmtImage indicates image/png clipboard format
 	FmtImage
+	// FmtFilepath indicates copied files, their paths separated by "\n"
 	FmtFilepath
+	// FmtHTML indicates HTML, UTF-8 encoded
+	FmtHTML
+	// FmtRTF indicates rich text, the RTF document as is
+	FmtRTF
+	// FmtURL indicates a single URL, UTF-8 encoded
+	FmtURL
+)
+
+// Types of the representations every backend understands. They are the
+// canonical names of the format registry, see package format, which
+// other types are looked up in before being used as native names (UTIs,
+// MIME types, X11 atoms, Windows format names).
+const (
+	TypeText  = format.Text
+	TypeHTML  = format.HTML
+	TypePNG   = format.PNG
+	TypeFiles = format.URIList
+	TypeRTF   = format.RTF
+	TypeURL   = format.URL
 )
 
+// Representation is the clipboard content in one format. Text and HTML
+// are UTF-8, images PNG encoded and files newline separated paths, even
+// though their type is text/uri-list.
+type Representation struct {
+	Type string
+	Data []byte
+}
+
 type ClipboardContent struct {
 	Type  string // text纯文本 file文件 png图片 html富文本
 	Data  interface{}
 	Error error
+	// Selection is the selection the content was read from.
+	Selection Selection
 }
 
 var (
@@ -39,6 +72,402 @@ var (
 	initError error
 )
 
+// Clipboard is a clipboard backed by a Backend, such as one selection of
+// the system clipboard or an in-memory fake. The package level
+// functions operate on a default Clipboard backed by the system
+// clipboard, see Default and Use.
+type Clipboard struct {
+	mu        sync.Mutex
+	backend   Backend
+	selection Selection
+	retry     *RetryPolicy
+	logger    *slog.Logger
+}
+
+// New returns a Clipboard backed by b, configured by opts.
+func New(b Backend, opts ...Option) *Clipboard {
+	c := &Clipboard{backend: b}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+var std = New(native_backend{})
+
+// Default returns the Clipboard used by the package level functions.
+func Default() *Clipboard {
+	return std
+}
+
+// Backend returns the backend of c.
+func (c *Clipboard) Backend() Backend {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.backend
+}
+
+func (c *Clipboard) set_backend(b Backend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backend = b
+}
+
+// SetRetryPolicy sets how operations on c are retried while the
+// clipboard is busy, replacing DefaultRetryPolicy.
+func (c *Clipboard) SetRetryPolicy(p RetryPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retry = &p
+}
+
+// do calls f, which reads or writes (op) the content as type name and
+// returns its size, with the backend of c. The backend is bound to ctx
+// when it can wait for other applications, and f is retried while the
+// clipboard is busy. do returns the backend of c for wrote.
+func (c *Clipboard) do(ctx context.Context, op string, name string, f func(b Backend) (int, error)) (Backend, error) {
+	c.mu.Lock()
+	b, p := c.backend, DefaultRetryPolicy
+	if c.retry != nil {
+		p = *c.retry
+	}
+	c.mu.Unlock()
+	bound := b
+	if cb, ok := b.(context_backend); ok {
+		bound = cb.with_context(ctx)
+	}
+	l := c.log()
+	start := time.Now()
+	size := 0
+	err := p.do(ctx, l, func() (err error) {
+		size, err = f(bound)
+		return err
+	})
+	log_op(ctx, l, b, op, name, size, start, err)
+	return b, err
+}
+
+func (c *Clipboard) ReadText() (string, error) {
+	return c.ReadTextContext(context.Background())
+}
+func (c *Clipboard) ReadHTML() (string, error) {
+	return c.ReadHTMLContext(context.Background())
+}
+func (c *Clipboard) ReadImage() ([]byte, error) {
+	return c.ReadImageContext(context.Background())
+}
+func (c *Clipboard) ReadFiles() ([]string, error) {
+	return c.ReadFilesContext(context.Background())
+}
+func (c *Clipboard) WriteText(text string) error {
+	return c.WriteTextContext(context.Background(), text)
+}
+func (c *Clipboard) WriteHTML(text string) error {
+	return c.WriteHTMLContext(context.Background(), text)
+}
+func (c *Clipboard) WriteImage(data []byte) error {
+	return c.WriteImageContext(context.Background(), data)
+}
+func (c *Clipboard) WriteFiles(files []string) error {
+	return c.WriteFilesContext(context.Background(), files)
+}
+
+// WriteTextOwned is WriteText returning the Ownership of the content it
+// wrote, as do the other Owned variants.
+func (c *Clipboard) WriteTextOwned(text string) (*Ownership, error) {
+	return c.WriteTextOwnedContext(context.Background(), text)
+}
+func (c *Clipboard) WriteHTMLOwned(text string) (*Ownership, error) {
+	return c.WriteHTMLOwnedContext(context.Background(), text)
+}
+func (c *Clipboard) WriteImageOwned(data []byte) (*Ownership, error) {
+	return c.WriteImageOwnedContext(context.Background(), data)
+}
+func (c *Clipboard) WriteFilesOwned(files []string) (*Ownership, error) {
+	return c.WriteFilesOwnedContext(context.Background(), files)
+}
+
+// ReadTextContext is ReadText giving up once ctx is done. The context
+// variants return ctx.Err() when ctx is canceled and ErrBusy when its
+// deadline passes, as the clipboard was busy or its owner did not
+// answer in time.
+func (c *Clipboard) ReadTextContext(ctx context.Context) (text string, err error) {
+	_, err = c.do(ctx, "read", TypeText, func(b Backend) (_ int, err error) {
+		text, err = b.ReadText()
+		return len(text), err
+	})
+	return text, err
+}
+func (c *Clipboard) ReadHTMLContext(ctx context.Context) (html string, err error) {
+	_, err = c.do(ctx, "read", TypeHTML, func(b Backend) (_ int, err error) {
+		html, err = b.ReadHTML()
+		return len(html), err
+	})
+	return html, err
+}
+func (c *Clipboard) ReadImageContext(ctx context.Context) (data []byte, err error) {
+	_, err = c.do(ctx, "read", TypePNG, func(b Backend) (_ int, err error) {
+		data, err = b.ReadImage()
+		return len(data), err
+	})
+	return data, err
+}
+func (c *Clipboard) ReadFilesContext(ctx context.Context) (files []string, err error) {
+	_, err = c.do(ctx, "read", TypeFiles, func(b Backend) (_ int, err error) {
+		files, err = b.ReadFiles()
+		return len(files), err
+	})
+	return files, err
+}
+func (c *Clipboard) WriteTextContext(ctx context.Context, text string) error {
+	_, err := c.WriteTextOwnedContext(ctx, text)
+	return err
+}
+func (c *Clipboard) WriteTextOwnedContext(ctx context.Context, text string) (*Ownership, error) {
+	return c.wrote(c.do(ctx, "write", TypeText, func(b Backend) (int, error) {
+		return len(text), b.WriteText(text)
+	}))
+}
+func (c *Clipboard) WriteHTMLContext(ctx context.Context, text string) error {
+	_, err := c.WriteHTMLOwnedContext(ctx, text)
+	return err
+}
+func (c *Clipboard) WriteHTMLOwnedContext(ctx context.Context, text string) (*Ownership, error) {
+	return c.wrote(c.do(ctx, "write", TypeHTML, func(b Backend) (int, error) {
+		return len(text), b.WriteHTML(text)
+	}))
+}
+func (c *Clipboard) WriteImageContext(ctx context.Context, data []byte) error {
+	_, err := c.WriteImageOwnedContext(ctx, data)
+	return err
+}
+func (c *Clipboard) WriteImageOwnedContext(ctx context.Context, data []byte) (*Ownership, error) {
+	return c.wrote(c.do(ctx, "write", TypePNG, func(b Backend) (int, error) {
+		return len(data), b.WriteImage(data)
+	}))
+}
+func (c *Clipboard) WriteFilesContext(ctx context.Context, files []string) error {
+	_, err := c.WriteFilesOwnedContext(ctx, files)
+	return err
+}
+func (c *Clipboard) WriteFilesOwnedContext(ctx context.Context, files []string) (*Ownership, error) {
+	return c.wrote(c.do(ctx, "write", TypeFiles, func(b Backend) (int, error) {
+		return len(files), b.WriteFiles(files)
+	}))
+}
+
+// Read returns the content of c in format t, encoded as described at
+// Format.
+func (c *Clipboard) Read(t Format) ([]byte, error) {
+	return c.ReadContext(context.Background(), t)
+}
+
+// ReadContext is Read giving up once ctx is done.
+func (c *Clipboard) ReadContext(ctx context.Context, t Format) ([]byte, error) {
+	switch t {
+	case FmtText:
+		text, err := c.ReadTextContext(ctx)
+		return []byte(text), err
+	case FmtImage:
+		return c.ReadImageContext(ctx)
+	case FmtFilepath:
+		files, err := c.ReadFilesContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.Join(files, "\n")), nil
+	case FmtHTML:
+		html, err := c.ReadHTMLContext(ctx)
+		return []byte(html), err
+	case FmtRTF:
+		return c.ReadFormatContext(ctx, TypeRTF)
+	case FmtURL:
+		data, err := c.ReadFormatContext(ctx, TypeURL)
+		if err != nil {
+			return nil, err
+		}
+		// Drop the title and terminator some systems add.
+		url, _, _ := strings.Cut(strings.TrimRight(string(data), "\x00"), "\n")
+		return []byte(strings.TrimSpace(url)), nil
+	}
+	return nil, err_unsupported
+}
+
+// Write replaces the content of c with buf in format t, encoded as
+// described at Format. A URL is written with a plain text fallback.
+func (c *Clipboard) Write(t Format, buf []byte) (*Ownership, error) {
+	return c.WriteContext(context.Background(), t, buf)
+}
+
+// WriteContext is Write giving up once ctx is done.
+func (c *Clipboard) WriteContext(ctx context.Context, t Format, buf []byte) (*Ownership, error) {
+	switch t {
+	case FmtText:
+		return c.WriteTextOwnedContext(ctx, string(buf))
+	case FmtImage:
+		return c.WriteImageOwnedContext(ctx, buf)
+	case FmtFilepath:
+		var files []string
+		for _, f := range strings.Split(string(buf), "\n") {
+			if f = strings.TrimSuffix(f, "\r"); f != "" {
+				files = append(files, f)
+			}
+		}
+		return c.WriteFilesOwnedContext(ctx, files)
+	case FmtHTML:
+		return c.WriteHTMLOwnedContext(ctx, string(buf))
+	case FmtRTF:
+		return c.WriteFormatContext(ctx, TypeRTF, buf)
+	case FmtURL:
+		return c.WriteAllContext(ctx,
+			Representation{Type: TypeURL, Data: buf},
+			Representation{Type: TypeText, Data: buf},
+		)
+	}
+	return nil, err_unsupported
+}
+
+// ReadFormat returns the content of c as type name, see Backend.
+func (c *Clipboard) ReadFormat(name string) ([]byte, error) {
+	return c.ReadFormatContext(context.Background(), name)
+}
+
+// ReadFormatContext is ReadFormat giving up once ctx is done.
+func (c *Clipboard) ReadFormatContext(ctx context.Context, name string) (data []byte, err error) {
+	_, err = c.do(ctx, "read", name, func(b Backend) (_ int, err error) {
+		data, err = b.ReadFormat(name)
+		return len(data), err
+	})
+	return data, err
+}
+
+// WriteFormat replaces the content of c with data of type name, which
+// may be private to the application, for example
+// "application/x-myapp-state".
+func (c *Clipboard) WriteFormat(name string, data []byte) (*Ownership, error) {
+	return c.WriteFormatContext(context.Background(), name, data)
+}
+
+// WriteFormatContext is WriteFormat giving up once ctx is done.
+func (c *Clipboard) WriteFormatContext(ctx context.Context, name string, data []byte) (*Ownership, error) {
+	return c.WriteAllContext(ctx, Representation{Type: name, Data: data})
+}
+
+// ReadAll returns every representation of the content of c.
+func (c *Clipboard) ReadAll() ([]Representation, error) {
+	return c.ReadAllContext(context.Background())
+}
+
+// ReadAllContext is ReadAll giving up once ctx is done.
+func (c *Clipboard) ReadAllContext(ctx context.Context) (items []Representation, err error) {
+	_, err = c.do(ctx, "read", "*", func(b Backend) (_ int, err error) {
+		items, err = b.ReadAll()
+		return total_size(items), err
+	})
+	return items, err
+}
+
+// WriteAll replaces the content of c with items at once, so that for
+// example HTML can be written along with a plain text fallback:
+//
+//	c.WriteAll(
+//		clipboard.Representation{Type: clipboard.TypeHTML, Data: []byte("<b>hi</b>")},
+//		clipboard.Representation{Type: clipboard.TypeText, Data: []byte("hi")},
+//	)
+//
+// Like every write it returns an Ownership telling when the content is
+// replaced.
+func (c *Clipboard) WriteAll(items ...Representation) (*Ownership, error) {
+	return c.WriteAllContext(context.Background(), items...)
+}
+
+// WriteAllContext is WriteAll giving up once ctx is done.
+func (c *Clipboard) WriteAllContext(ctx context.Context, items ...Representation) (*Ownership, error) {
+	return c.wrote(c.do(ctx, "write", item_types(items), func(b Backend) (int, error) {
+		return total_size(items), b.WriteAll(items...)
+	}))
+}
+
+// Watch returns a channel receiving the content of c after every
+// change, it is closed once ctx is canceled. Only the richest type is
+// read, use Events to choose.
+func (c *Clipboard) Watch(ctx context.Context) <-chan ClipboardContent {
+	recv := make(chan ClipboardContent, 1)
+	events := c.Events(ctx)
+	go func() {
+		defer close(recv)
+		for e := range events {
+			select {
+			case recv <- e.content():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return recv
+}
+
+// GetContentTypes lists the types currently on c. params only matter to
+// the native backend on Windows, where a busy clipboard is retried
+// following the retry policy of c.
+func (c *Clipboard) GetContentTypes(params ContentTypeParams) []string {
+	b := c.Backend()
+	if _, ok := b.(native_backend); !ok {
+		return b.ContentTypes()
+	}
+	var types []string
+	c.do(context.Background(), "list", "*", func(Backend) (int, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		var err error
+		types, err = get_content_types(params)
+		return len(types), err
+	})
+	return types
+}
+
+// How often WaitForChange polls backends without change notification.
+const change_poll_interval = 200 * time.Millisecond
+
+// ChangeCount returns a number which increases whenever the content of c
+// changes, by this or another application.
+func (c *Clipboard) ChangeCount() uint64 {
+	return c.Backend().ChangeCount()
+}
+
+// WaitForChange blocks until the change count of c differs from since
+// and returns the new count. It returns right away when the content
+// changed after since was obtained, so that nothing is missed:
+//
+//	since := c.ChangeCount()
+//	// ...
+//	count, err := c.WaitForChange(ctx, since)
+func (c *Clipboard) WaitForChange(ctx context.Context, since uint64) (uint64, error) {
+	return wait_for_change(ctx, c.Backend(), since)
+}
+
+func wait_for_change(ctx context.Context, b Backend, since uint64) (uint64, error) {
+	changed, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	var tick <-chan time.Time
+	if changed == nil {
+		ti := time.NewTicker(change_poll_interval)
+		defer ti.Stop()
+		tick = ti.C
+	}
+	for {
+		if count := b.ChangeCount(); count != since {
+			return count, nil
+		}
+		select {
+		case <-ctx.Done():
+			return since, ctx.Err()
+		case <-changed:
+		case <-tick:
+		}
+	}
+}
+
 // Init initializes the clipboard package. It returns an error
 // if the clipboard is not available to use. This may happen if the
 // target system lacks required dependency, such as libx11-dev in X11
@@ -59,43 +488,51 @@ func Init() error {
 }
 
 // Read returns a chunk of bytes of the clipboard data if it presents
-// in the desired format t presents. Otherwise, it returns nil.
+// in the desired format t presents, encoded as described at Format.
 func Read(t Format) ([]byte, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	buf, err := read(t)
-	if err != nil {
-		return nil, err
-	}
-	return buf, nil
+	return std.Read(t)
 }
 func ReadText() (string, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	t, err := read_text()
-	if err != nil {
-		return "", nil
-	}
-	return t, nil
+	return std.ReadText()
 }
 func ReadHTML() (string, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	t, err := read_html()
-	if err != nil {
-		return "", nil
-	}
-	return t, nil
+	return std.ReadHTML()
 }
 func ReadImage() ([]byte, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	return read_image()
+	return std.ReadImage()
 }
 func ReadFiles() ([]string, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	return read_files()
+	return std.ReadFiles()
+}
+func ReadFormat(name string) ([]byte, error) {
+	return std.ReadFormat(name)
+}
+func ReadAll() ([]Representation, error) {
+	return std.ReadAll()
+}
+
+// ReadContext is Read giving up once ctx is done, see
+// Clipboard.ReadTextContext.
+func ReadContext(ctx context.Context, t Format) ([]byte, error) {
+	return std.ReadContext(ctx, t)
+}
+func ReadTextContext(ctx context.Context) (string, error) {
+	return std.ReadTextContext(ctx)
+}
+func ReadHTMLContext(ctx context.Context) (string, error) {
+	return std.ReadHTMLContext(ctx)
+}
+func ReadImageContext(ctx context.Context) ([]byte, error) {
+	return std.ReadImageContext(ctx)
+}
+func ReadFilesContext(ctx context.Context) ([]string, error) {
+	return std.ReadFilesContext(ctx)
+}
+func ReadFormatContext(ctx context.Context, name string) ([]byte, error) {
+	return std.ReadFormatContext(ctx, name)
+}
+func ReadAllContext(ctx context.Context) ([]Representation, error) {
+	return std.ReadAllContext(ctx)
 }
 
 // Write writes a given buffer to the clipboard in a specified format.
@@ -105,34 +542,87 @@ func ReadFiles() ([]string, error) {
 // If format t indicates an image, then the given buf assumes
 // the image data is PNG encoded.
 func Write(t Format, buf []byte) (<-chan struct{}, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	changed, err := write(t, buf)
+	o, err := std.Write(t, buf)
 	if err != nil {
 		return nil, err
 	}
-	return changed, nil
+	return o.Done(), nil
 }
 
 func WriteText(text string) error {
-	lock.Lock()
-	defer lock.Unlock()
-	return write_text(text)
+	return std.WriteText(text)
 }
 func WriteHTML(text string) error {
-	lock.Lock()
-	defer lock.Unlock()
-	return write_html(text)
+	return std.WriteHTML(text)
 }
 func WriteImage(data []byte) error {
-	lock.Lock()
-	defer lock.Unlock()
-	return write_image(data)
+	return std.WriteImage(data)
 }
 func WriteFiles(files []string) error {
-	lock.Lock()
-	defer lock.Unlock()
-	return write_files(files)
+	return std.WriteFiles(files)
+}
+func WriteTextOwned(text string) (*Ownership, error) {
+	return std.WriteTextOwned(text)
+}
+func WriteHTMLOwned(text string) (*Ownership, error) {
+	return std.WriteHTMLOwned(text)
+}
+func WriteImageOwned(data []byte) (*Ownership, error) {
+	return std.WriteImageOwned(data)
+}
+func WriteFilesOwned(files []string) (*Ownership, error) {
+	return std.WriteFilesOwned(files)
+}
+func WriteFormat(name string, data []byte) (*Ownership, error) {
+	return std.WriteFormat(name, data)
+}
+func WriteAll(items ...Representation) (*Ownership, error) {
+	return std.WriteAll(items...)
+}
+
+// WriteContext is Write giving up once ctx is done.
+func WriteContext(ctx context.Context, t Format, buf []byte) (<-chan struct{}, error) {
+	o, err := std.WriteContext(ctx, t, buf)
+	if err != nil {
+		return nil, err
+	}
+	return o.Done(), nil
+}
+func WriteTextContext(ctx context.Context, text string) error {
+	return std.WriteTextContext(ctx, text)
+}
+func WriteHTMLContext(ctx context.Context, text string) error {
+	return std.WriteHTMLContext(ctx, text)
+}
+func WriteImageContext(ctx context.Context, data []byte) error {
+	return std.WriteImageContext(ctx, data)
+}
+func WriteFilesContext(ctx context.Context, files []string) error {
+	return std.WriteFilesContext(ctx, files)
+}
+func WriteTextOwnedContext(ctx context.Context, text string) (*Ownership, error) {
+	return std.WriteTextOwnedContext(ctx, text)
+}
+func WriteHTMLOwnedContext(ctx context.Context, text string) (*Ownership, error) {
+	return std.WriteHTMLOwnedContext(ctx, text)
+}
+func WriteImageOwnedContext(ctx context.Context, data []byte) (*Ownership, error) {
+	return std.WriteImageOwnedContext(ctx, data)
+}
+func WriteFilesOwnedContext(ctx context.Context, files []string) (*Ownership, error) {
+	return std.WriteFilesOwnedContext(ctx, files)
+}
+func WriteFormatContext(ctx context.Context, name string, data []byte) (*Ownership, error) {
+	return std.WriteFormatContext(ctx, name, data)
+}
+func WriteAllContext(ctx context.Context, items ...Representation) (*Ownership, error) {
+	return std.WriteAllContext(ctx, items...)
+}
+
+// SetRetryPolicy sets how operations on the clipboard are retried while
+// it is busy.
+func SetRetryPolicy(p RetryPolicy) {
+	std.SetRetryPolicy(p)
 }
 
 // Watch returns a receive-only channel that received the clipboard data
@@ -140,7 +630,7 @@ func WriteFiles(files []string) error {
 //
 // The returned channel will be closed if the given context is canceled.
 func Watch(ctx context.Context) <-chan ClipboardContent {
-	return watch(ctx)
+	return std.Watch(ctx)
 }
 
 type ContentTypeParams struct {
@@ -148,7 +638,19 @@ type ContentTypeParams struct {
 }
 
 func GetContentTypes(params ContentTypeParams) []string {
-	return get_content_types(params)
+	return std.GetContentTypes(params)
+}
+
+// ChangeCount returns a number which increases whenever the content of
+// the clipboard changes.
+func ChangeCount() uint64 {
+	return std.ChangeCount()
+}
+
+// WaitForChange blocks until the change count of the clipboard differs
+// from since and returns the new count.
+func WaitForChange(ctx context.Context, since uint64) (uint64, error) {
+	return std.WaitForChange(ctx, since)
 }
 
 func ByteToStrArray(b []byte) ([]string, error) {
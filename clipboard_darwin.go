@@ -4,13 +4,16 @@ package clipboard
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
-	"time"
 	"unsafe"
 
 	"github.com/ebitengine/purego"
 	"github.com/ebitengine/purego/objc"
+	"github.com/ltaoo/clipboard-go/pkg/format"
+	"github.com/ltaoo/clipboard-go/pkg/urilist"
 )
 
 func must(sym uintptr, err error) uintptr {
@@ -43,14 +46,15 @@ var (
 	_changeCount              = objc.RegisterName("changeCount")
 	_dataForType              = objc.RegisterName("dataForType:")
 	_setDataForType           = objc.RegisterName("setData:forType:")
-	_propertyListForType      = objc.RegisterName("propertyListForType:")
+	_pasteboardItems          = objc.RegisterName("pasteboardItems")
+	_stringForType            = objc.RegisterName("stringForType:")
 	_writeObjects             = objc.RegisterName("writeObjects:")
 	_setPropertyList_forType_ = objc.RegisterName("setPropertyListForType:")
 	// https://developer.apple.com/documentation/appkit/nspasteboard/pasteboardtype?language=objc
-	_NSPasteboardTypeString = must2(purego.Dlsym(appkit, "NSPasteboardTypeString"))
-	_NSPasteboardTypeHTML   = must2(purego.Dlsym(appkit, "NSPasteboardTypeHTML"))
-	_NSPasteboardTypePNG    = must2(purego.Dlsym(appkit, "NSPasteboardTypePNG"))
-	_NSPasteboardTypeFiles  = must2(purego.Dlsym(appkit, "NSFilenamesPboardType"))
+	_NSPasteboardTypeString  = must2(purego.Dlsym(appkit, "NSPasteboardTypeString"))
+	_NSPasteboardTypeHTML    = must2(purego.Dlsym(appkit, "NSPasteboardTypeHTML"))
+	_NSPasteboardTypePNG     = must2(purego.Dlsym(appkit, "NSPasteboardTypePNG"))
+	_NSPasteboardTypeFileURL = must2(purego.Dlsym(appkit, "NSPasteboardTypeFileURL"))
 
 	_NSMutableArray         = objc.GetClass("NSMutableArray")
 	_NSArray                = objc.GetClass("NSArray")
@@ -65,8 +69,10 @@ var (
 	_UTF8String           = objc.RegisterName("UTF8String")
 	_stringWithUTF8String = objc.RegisterName("stringWithUTF8String:")
 
-	_NSURL           = objc.GetClass("NSURL")
-	_fileURLWithPath = objc.RegisterName("fileURLWithPath:")
+	_NSURL          = objc.GetClass("NSURL")
+	_URLWithString  = objc.RegisterName("URLWithString:")
+	_filePathURL    = objc.RegisterName("filePathURL")
+	_absoluteString = objc.RegisterName("absoluteString")
 
 	_init   = objc.RegisterName("init")
 	_alloc  = objc.RegisterName("alloc")
@@ -76,151 +82,43 @@ var (
 
 func initialize() error { return nil }
 
-func read(t Format) (buf []byte, err error) {
-	switch t {
-	// case FmtText:
-	// 	return read_text(), nil
-	// case FmtImage:
-	// 	return read_image(), nil
-	// case FmtFilepath:
-	// 	return read_files(), nil
+// native_selection only supports the clipboard, macOS has no other
+// selections.
+func native_selection(s Selection) (Backend, error) {
+	if s != SelectionClipboard {
+		return nil, fmt.Errorf("%w: the %v selection is not supported on macOS", ErrUnsupportedPlatform, s)
 	}
-	return nil, err_unavailable
+	return native_backend{}, nil
 }
 
-func write(t Format, buf []byte) (<-chan struct{}, error) {
-	// var ok bool
-	switch t {
-	// case FmtText:
-	// 	if len(buf) == 0 {
-	// 		ok = write_text(nil)
-	// 	} else {
-	// 		ok = write_text(buf)
-
-	// 	}
-	// case FmtImage:
-	// 	if len(buf) == 0 {
-	// 		ok = write_image(nil)
-	// 	} else {
-	// 		ok = write_image(buf)
-	// 	}
-	// case FmtFilepath:
-	// 	if len(buf) == 0 {
-	// 		ok = write_files(nil)
-	// 	} else {
-	// 		ok = write_files(buf)
-	// 	}
-	default:
-		return nil, err_unsupported
-	}
-	// if !ok {
-	// 	return nil, err_unavailable
-	// }
-	changed := make(chan struct{}, 1)
-	cnt := get_change_count()
-	go func() {
-		for {
-			// not sure if we are too slow or the user too fast :)
-			time.Sleep(time.Second)
-			cur := get_change_count()
-			if cnt != cur {
-				changed <- struct{}{}
-				close(changed)
-				return
-			}
-		}
-	}()
-	return changed, nil
+// native_context ignores ctx, the pasteboard never waits for other
+// applications.
+func native_context(ctx context.Context) Backend {
+	return native_backend{}
 }
 
-func watch(ctx context.Context) <-chan ClipboardContent {
-	recv := make(chan ClipboardContent, 1)
-	ti := time.NewTicker(time.Second)
-	prev_count := get_change_count()
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				close(recv)
-				return
-			case <-ti.C:
-				cur_count := get_change_count()
-				if prev_count != cur_count {
-					prev_count = cur_count
-
-					content := read_content_with_type(ContentTypeParams{IsEnabled: false})
-					recv <- content
-				}
-			}
-		}
-	}()
-	return recv
+func native_name() string {
+	return "darwin"
 }
 
-func read_content_with_type(params ContentTypeParams) ClipboardContent {
-	cur_types := get_content_types(params)
-	var maybe_type string
-	for _, t := range cur_types {
-		if t == "public.html" {
-			maybe_type = t
-			text, err := read_html()
-			d := ClipboardContent{
-				Type:  maybe_type,
-				Data:  text,
-				Error: nil,
-			}
-			if err != nil {
-				d.Error = fmt.Errorf("读取类型为 %v 的内容时失败，因为%v", maybe_type, err.Error())
-			}
-			return d
-		}
-		if t == "public.utf8-plain-text" {
-			maybe_type = t
-			text, err := read_text()
-			d := ClipboardContent{
-				Type:  maybe_type,
-				Data:  text,
-				Error: nil,
-			}
-			if err != nil {
-				d.Error = fmt.Errorf("读取类型为 %v 的内容时失败，因为%v", maybe_type, err.Error())
-			}
-			return d
-		}
-		if t == "public.file-url" {
-			maybe_type = t
-			files, err := read_files()
-			d := ClipboardContent{
-				Type:  maybe_type,
-				Data:  files,
-				Error: nil,
-			}
-			if err != nil {
-				d.Error = fmt.Errorf("读取类型为 %v 的内容时失败，因为%v", maybe_type, err.Error())
-			}
-			return d
+// native_operation_types returns nil, Finder does not tell cut files
+// from copied ones.
+func native_operation_types() []string {
+	return nil
+}
 
-		}
-		if t == "public.png" {
-			maybe_type = t
-			image, err := read_image()
-			d := ClipboardContent{
-				Type:  maybe_type,
-				Data:  image,
-				Error: nil,
-			}
-			if err != nil {
-				d.Error = fmt.Errorf("读取类型为 %v 的内容时失败，因为%v", maybe_type, err.Error())
-			}
-			return d
-		}
-	}
-	type_text := strings.Join(cur_types, "\n")
-	return ClipboardContent{
-		Type:  type_text,
-		Data:  nil,
-		Error: fmt.Errorf("无法处理的内容类型"),
+// missing returns the error for data the pasteboard lacks, ErrEmpty
+// when it holds nothing at all.
+func missing(detail string) error {
+	if types, _ := get_content_types(ContentTypeParams{IsEnabled: true}); len(types) == 0 {
+		return ErrEmpty
 	}
+	return fmt.Errorf("%w: %v", ErrFormatUnavailable, detail)
+}
+
+// subscribe returns a nil channel, the change count is polled.
+func subscribe() (<-chan struct{}, func()) {
+	return nil, func() {}
 }
 
 func read_text() (string, error) {
@@ -228,16 +126,16 @@ func read_text() (string, error) {
 	__data := __pasteboard.Send(_dataForType, _NSPasteboardTypeString)
 	// __data := __pasteboard.Send(_dataForType, _NSPasteboardTypeHTML)
 	if __data == 0 {
-		return "", fmt.Errorf("读取数据失败")
+		return "", missing("no data")
 	}
 	size := uint(__data.Send(_length))
 	if size == 0 {
-		return "", fmt.Errorf("获取文本长度失败")
+		return "", nil
 	}
 	out := make([]byte, size)
 	__r := __data.Send(_getBytesLength, unsafe.SliceData(out), size)
 	if __r == 0 {
-		return "", fmt.Errorf("转换数据失败")
+		return "", fmt.Errorf("%w: copying the data failed", ErrSystem)
 	}
 	text := string(out)
 	return text, nil
@@ -247,16 +145,16 @@ func read_html() (string, error) {
 	__pasteboard := objc.ID(_NSPasteboard).Send(_generalPasteboard)
 	__data := __pasteboard.Send(_dataForType, _NSPasteboardTypeHTML)
 	if __data == 0 {
-		return "", fmt.Errorf("读取数据失败")
+		return "", missing("no data")
 	}
 	size := uint(__data.Send(_length))
 	if size == 0 {
-		return "", fmt.Errorf("获取文本长度失败")
+		return "", nil
 	}
 	out := make([]byte, size)
 	__r := __data.Send(_getBytesLength, unsafe.SliceData(out), size)
 	if __r == 0 {
-		return "", fmt.Errorf("转换数据失败")
+		return "", fmt.Errorf("%w: copying the data failed", ErrSystem)
 	}
 	text := string(out)
 	return text, nil
@@ -266,38 +164,54 @@ func read_image() ([]byte, error) {
 	__pasteboard := objc.ID(_NSPasteboard).Send(_generalPasteboard)
 	__data := __pasteboard.Send(_dataForType, _NSPasteboardTypePNG)
 	if __data == 0 {
-		return nil, fmt.Errorf("读取数据失败")
+		return nil, missing("no data")
 	}
 	size := uint(__data.Send(_length))
 	if size == 0 {
-		return nil, fmt.Errorf("图片内容为空")
+		return nil, fmt.Errorf("%w: empty image", ErrFormatUnavailable)
 	}
 	out := make([]byte, size)
 	__r := __data.Send(_getBytesLength, unsafe.SliceData(out), size)
 	if __r == 0 {
-		return nil, fmt.Errorf("转换数据失败")
+		return nil, fmt.Errorf("%w: copying the data failed", ErrSystem)
 	}
 	return out, nil
 }
 
+// read_files reads the file URL of every pasteboard item, see
+// NSPasteboardTypeFileURL.
 func read_files() ([]string, error) {
 	__pasteboard := objc.ID(_NSPasteboard).Send(_generalPasteboard)
-	__data := __pasteboard.Send(_propertyListForType, _NSPasteboardTypeFiles)
-	if __data == 0 {
-		return nil, fmt.Errorf("读取内容失败")
-	}
-	count := uint(__data.Send(_count))
-	if count == 0 {
-		return nil, fmt.Errorf("没有找到文件")
+	__items := __pasteboard.Send(_pasteboardItems)
+	if __items == 0 {
+		return nil, missing("no pasteboard items")
 	}
 	var files []string
-	for i := 0; i < int(count); i++ {
-		__file := __data.Send(_objectAtIndex, i)
-		utf8_ptr := unsafe.Pointer(__file.Send(_UTF8String))
-		if utf8_ptr == nil {
+	count := int(__items.Send(_count))
+	for i := 0; i < count; i++ {
+		__uri := __items.Send(_objectAtIndex, i).Send(_stringForType, _NSPasteboardTypeFileURL)
+		if __uri == 0 {
 			continue
 		}
-		files = append(files, pointer_to_utf8_string(utf8_ptr))
+		uri := ns_string(__uri)
+		// Finder puts file reference URLs like file:///.file/id=6571367.2773272/
+		// on the pasteboard, they are resolved to the path of the file.
+		if strings.HasPrefix(uri, "file:///.file/") {
+			__url := objc.ID(_NSURL).Send(_URLWithString, __uri).Send(_filePathURL)
+			if __url == 0 {
+				continue
+			}
+			uri = ns_string(__url.Send(_absoluteString))
+		}
+		f, err := urilist.ToPath(uri)
+		if err != nil {
+			native_log().Debug("skipping unrecognized file URL", "uri", uri, "error", err)
+			continue
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, missing("no file URLs")
 	}
 	return files, nil
 }
@@ -306,19 +220,19 @@ func write_text(text string) error {
 	bytes := []byte(text)
 	__pasteboard := objc.ID(_NSPasteboard).Send(_generalPasteboard)
 	if __pasteboard == 0 {
-		return fmt.Errorf("获取粘贴板失败")
+		return fmt.Errorf("%w: no general pasteboard", ErrSystem)
 	}
 	__data := objc.ID(_NSData).Send(_dataWithBytesLength, unsafe.SliceData(bytes), len(bytes))
 	if __data == 0 {
-		return fmt.Errorf("初始化数据失败")
+		return fmt.Errorf("%w: creating NSData failed", ErrTooLarge)
 	}
 	__r := __pasteboard.Send(_clearContents)
 	if __r == 0 {
-		return fmt.Errorf("清空粘贴板失败")
+		return fmt.Errorf("%w: clearing the pasteboard failed", ErrSystem)
 	}
 	__r2 := __pasteboard.Send(_setDataForType, __data, _NSPasteboardTypeString)
 	if __r2 == 0 {
-		return fmt.Errorf("写入文本失败")
+		return fmt.Errorf("%w: writing the text failed", ErrSystem)
 	}
 	return nil
 }
@@ -327,81 +241,184 @@ func write_html(text string) error {
 	bytes := []byte(text)
 	__pasteboard := objc.ID(_NSPasteboard).Send(_generalPasteboard)
 	if __pasteboard == 0 {
-		return fmt.Errorf("获取粘贴板失败")
+		return fmt.Errorf("%w: no general pasteboard", ErrSystem)
 	}
 	__data := objc.ID(_NSData).Send(_dataWithBytesLength, unsafe.SliceData(bytes), len(bytes))
 	if __data == 0 {
-		return fmt.Errorf("初始化数据失败")
+		return fmt.Errorf("%w: creating NSData failed", ErrTooLarge)
 	}
 	__r := __pasteboard.Send(_clearContents)
 	if __r == 0 {
-		return fmt.Errorf("清空粘贴板失败")
+		return fmt.Errorf("%w: clearing the pasteboard failed", ErrSystem)
 	}
 	__r2 := __pasteboard.Send(_setDataForType, __data, _NSPasteboardTypeHTML)
 	if __r2 == 0 {
-		return fmt.Errorf("写入文本失败")
+		return fmt.Errorf("%w: writing the text failed", ErrSystem)
 	}
 	return nil
 }
 
 func write_image(bytes []byte) error {
-	__pasteboard := objc.ID(_NSPasteboard).Send(_generalPasteboard)
-	if __pasteboard == 0 {
-		return fmt.Errorf("获取粘贴板失败")
-	}
-	__data := objc.ID(_NSData).Send(_dataWithBytesLength, unsafe.SliceData(bytes), len(bytes))
-	if __data == 0 {
-		return fmt.Errorf("初始化数据失败")
-	}
-	__r := __pasteboard.Send(_clearContents)
-	if __r == 0 {
-		return fmt.Errorf("清空粘贴板失败")
-	}
-	__r2 := __pasteboard.Send(_setDataForType, __data, _NSPasteboardTypePNG)
-	if __r2 == 0 {
-		return fmt.Errorf("写入图片失败")
-	}
-	return nil
+	return write_all([]Representation{{Type: TypePNG, Data: bytes}})
 }
 
 func write_files(files []string) error {
+	return write_all([]Representation{{Type: TypeFiles, Data: []byte(strings.Join(files, "\n"))}})
+}
+
+// file_urls returns files as an array of NSURL objects.
+func file_urls(files []string) (objc.ID, error) {
 	__arr := objc.ID(_NSMutableArray).Send(_alloc).Send(_init)
 	if __arr == 0 {
-		return fmt.Errorf("初始化失败")
+		return 0, fmt.Errorf("%w: creating the URL array failed", ErrSystem)
 	}
 	for _, f := range files {
-		file_str := (*int8)(unsafe.Pointer(&[]byte(f + "\x00")[0]))
-		__file_str := objc.ID(_NSString).Send(_stringWithUTF8String, file_str)
-		__file_url := objc.ID(_NSURL).Send(_fileURLWithPath, __file_str)
+		if f == "" {
+			continue
+		}
+		uri, err := urilist.FromPath(f)
+		if err != nil {
+			return 0, wrap(ErrInvalidContent, err)
+		}
+		__uri := objc.ID(_NSString).Send(_stringWithUTF8String, utf8_str_to_const(uri))
+		__file_url := objc.ID(_NSURL).Send(_URLWithString, __uri)
+		if __file_url == 0 {
+			return 0, fmt.Errorf("%w: invalid file URL %v", ErrInvalidContent, uri)
+		}
 		__arr.Send(_addObject, __file_url)
 	}
+	return __arr, nil
+}
 
+// write_all clears the pasteboard once and sets every item on it. Files
+// are written as NSURL objects, which adds the file-url types as well.
+func write_all(items []Representation) error {
 	__pasteboard := objc.ID(_NSPasteboard).Send(_generalPasteboard)
 	if __pasteboard == 0 {
-		return fmt.Errorf("获取粘贴板失败")
+		return fmt.Errorf("%w: no general pasteboard", ErrSystem)
+	}
+	// Paths and images are converted first, the pasteboard is left as it
+	// is when one of them is invalid.
+	var __urls []objc.ID
+	items = append([]Representation(nil), items...)
+	for i, item := range items {
+		switch item.Type {
+		case TypeFiles:
+			__arr, err := file_urls(strings.Split(string(item.Data), "\n"))
+			if err != nil {
+				return err
+			}
+			__urls = append(__urls, __arr)
+		case TypePNG:
+			if http.DetectContentType(item.Data) != "image/png" {
+				data, err := image_to_png(item.Data)
+				if err != nil {
+					return err
+				}
+				items[i].Data = data
+			}
+		}
 	}
 	__r := __pasteboard.Send(_clearContents)
 	if __r == 0 {
-		return fmt.Errorf("清空粘贴板失败")
+		return fmt.Errorf("%w: clearing the pasteboard failed", ErrSystem)
 	}
-	__r2 := __pasteboard.Send(_writeObjects, __arr)
-	if __r2 == 0 {
-		return fmt.Errorf("写入文件失败")
+	for _, __arr := range __urls {
+		__r2 := __pasteboard.Send(_writeObjects, __arr)
+		if __r2 == 0 {
+			return fmt.Errorf("%w: writing the files failed", ErrSystem)
+		}
 	}
-	__r3 := __pasteboard.Send(_propertyListForType, _NSPasteboardTypeFiles)
-	if __r3 == 0 {
-		return fmt.Errorf("写入文件失败2")
+	for _, item := range items {
+		if item.Type == TypeFiles {
+			continue
+		}
+		data := item.Data
+		__data := objc.ID(_NSData).Send(_dataWithBytesLength, unsafe.SliceData(data), len(data))
+		if __data == 0 {
+			return fmt.Errorf("%w: creating NSData failed", ErrTooLarge)
+		}
+		__type := objc.ID(_NSString).Send(_stringWithUTF8String, utf8_str_to_const(darwin_types(item.Type)[0]))
+		__r2 := __pasteboard.Send(_setDataForType, __data, __type)
+		if __r2 == 0 {
+			return fmt.Errorf("%w: writing %v failed", ErrSystem, item.Type)
+		}
 	}
 	return nil
 }
 
+// read_all returns the data of every type on the pasteboard, files as
+// newline separated paths.
+func read_all() ([]Representation, error) {
+	var items []Representation
+	types, _ := get_content_types(ContentTypeParams{IsEnabled: true})
+	for _, t := range types {
+		data, err := read_format(t)
+		if errors.Is(err, ErrFormatUnavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, Representation{Type: t, Data: data})
+	}
+	if len(items) == 0 {
+		return nil, ErrEmpty
+	}
+	return items, nil
+}
+
+// read_format returns the data of a registered format or of any other
+// pasteboard type, files as newline separated paths.
+func read_format(name string) ([]byte, error) {
+	if name == TypeFiles {
+		files, err := read_files()
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.Join(files, "\n")), nil
+	}
+	__pasteboard := objc.ID(_NSPasteboard).Send(_generalPasteboard)
+	if __pasteboard == 0 {
+		return nil, fmt.Errorf("%w: no general pasteboard", ErrSystem)
+	}
+	var __data objc.ID
+	for _, t := range darwin_types(name) {
+		__type := objc.ID(_NSString).Send(_stringWithUTF8String, utf8_str_to_const(t))
+		__data = __pasteboard.Send(_dataForType, __type)
+		if __data != 0 {
+			break
+		}
+	}
+	if __data == 0 {
+		return nil, missing(fmt.Sprintf("no data of type %v", name))
+	}
+	size := uint(__data.Send(_length))
+	out := make([]byte, size)
+	if size > 0 {
+		__data.Send(_getBytesLength, unsafe.SliceData(out), size)
+	}
+	return out, nil
+}
+
+// darwin_types returns the pasteboard types of the format called name,
+// or name itself when it is not registered.
+func darwin_types(name string) []string {
+	if f, ok := format.Lookup(name); ok && len(f.UTIs) > 0 {
+		return f.UTIs
+	}
+	return []string{name}
+}
+
 func get_change_count() int {
 	return int(objc.ID(_NSPasteboard).Send(_generalPasteboard).Send(_changeCount))
 }
-func get_content_types(params ContentTypeParams) []string {
-	if !params.IsEnabled {
-		// ...
-	}
+
+// ownership_lost returns nil, Ownership compares the change count.
+func ownership_lost(seq uint64) <-chan struct{} {
+	return nil
+}
+func get_content_types(params ContentTypeParams) ([]string, error) {
 	__data := objc.ID(_NSPasteboard).Send(_generalPasteboard).Send(_types)
 	__array := objc.ID(__data)
 	count := int(__array.Send(_count))
@@ -412,15 +429,30 @@ func get_content_types(params ContentTypeParams) []string {
 		if utf8_ptr == nil {
 			continue
 		}
-		strs = append(strs, pointer_to_utf8_string(utf8_ptr))
+		t := pointer_to_utf8_string(utf8_ptr)
+		if f, ok := format.FromUTI(t); ok {
+			t = f.Name
+		}
+		seen := false
+		for _, v := range strs {
+			seen = seen || v == t
+		}
+		if !seen {
+			strs = append(strs, t)
+		}
 	}
-	return strs
+	return strs, nil
 }
 
 func utf8_str_to_const(s string) *int8 {
 	return (*int8)(unsafe.Pointer(&[]byte(s + "\x00")[0]))
 }
 
+// ns_string returns the content of an NSString.
+func ns_string(__str objc.ID) string {
+	return pointer_to_utf8_string(unsafe.Pointer(__str.Send(_UTF8String)))
+}
+
 func pointer_to_utf8_string(ptr unsafe.Pointer) string {
 	if ptr == nil {
 		return ""
@@ -0,0 +1,466 @@
+//go:build linux
+
+package clipboard
+
+// On Linux the clipboard is a selection owned by some client of the
+// display server. Wayland compositors implementing a data-control
+// protocol are used when available, X11 (or XWayland) otherwise.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ltaoo/clipboard-go/pkg/format"
+	"github.com/ltaoo/clipboard-go/pkg/urilist"
+)
+
+// Content larger than this is refused rather than exhausting memory.
+const max_transfer = 1 << 30
+
+// linux_clipboard is a selection on either X11 or Wayland. Targets are
+// X11 atom names or MIME types, which both protocols share for every
+// format we care about.
+type linux_clipboard interface {
+	// convert returns the content of the selection as target, giving
+	// up once ctx is done.
+	convert(ctx context.Context, target string) ([]byte, error)
+	// own makes us the owner of the selection, serving values which maps
+	// targets to their data.
+	own(ctx context.Context, values map[string][]byte) error
+	// targets lists the targets the selection can be converted to.
+	targets(ctx context.Context) ([]string, error)
+	change_count() int
+	// lost returns a channel closed once the content we own, which
+	// change count seq belongs to, is replaced.
+	lost(seq uint64) <-chan struct{}
+	// subscribe returns a channel signalled after every change of the
+	// selection, or nil when the backend has to be polled.
+	subscribe() (<-chan struct{}, func())
+}
+
+var (
+	boards_mu   sync.Mutex
+	boards      = map[Selection]linux_clipboard{}
+	use_wayland bool
+)
+
+func initialize() error {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		w, err := new_wayland_clipboard("", false)
+		if err == nil {
+			boards[SelectionClipboard] = w
+			use_wayland = true
+			return nil
+		}
+		// GNOME for example has no data-control protocol, fall back to
+		// XWayland when it is running.
+		if os.Getenv("DISPLAY") == "" {
+			return wrap(ErrUnsupportedPlatform, err)
+		}
+		native_log().Info("Wayland clipboard unavailable, using X11", "error", err)
+	}
+	x, err := new_x11_clipboard("", SelectionClipboard.String())
+	if err != nil {
+		if os.Getenv("DISPLAY") == "" {
+			// No display server at all, such as on a headless machine.
+			return wrap(ErrUnsupportedPlatform, err)
+		}
+		return err
+	}
+	boards[SelectionClipboard] = x
+	return nil
+}
+
+// open_board returns the connection serving selection s, connecting on
+// first use. Every selection has its own connection so their events
+// never mix.
+func open_board(s Selection) (linux_clipboard, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+	boards_mu.Lock()
+	defer boards_mu.Unlock()
+	if b, ok := boards[s]; ok {
+		return b, nil
+	}
+	var b linux_clipboard
+	var err error
+	switch {
+	case s != SelectionPrimary && s != SelectionSecondary:
+		return nil, fmt.Errorf("%w: unknown selection %v", ErrUnsupportedPlatform, s)
+	case use_wayland && s == SelectionSecondary:
+		return nil, fmt.Errorf("%w: Wayland has no SECONDARY selection", ErrUnsupportedPlatform)
+	case use_wayland:
+		b, err = new_wayland_clipboard("", true)
+	default:
+		b, err = new_x11_clipboard("", s.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+	boards[s] = b
+	return b, nil
+}
+
+func native_selection(s Selection) (Backend, error) {
+	if s == SelectionClipboard {
+		return native_backend{}, nil
+	}
+	if _, err := open_board(s); err != nil {
+		return nil, err
+	}
+	return linux_backend{selection: s}, nil
+}
+
+// native_context returns the CLIPBOARD selection bound to ctx, whose
+// owner may take its time to answer.
+func native_context(ctx context.Context) Backend {
+	return linux_backend{ctx: ctx}
+}
+
+// native_name names the display server the clipboard is served by.
+func native_name() string {
+	if use_wayland {
+		return "wayland"
+	}
+	return "x11"
+}
+
+// native_operation_types lists the formats the file managers of GNOME
+// and KDE read the operation of copied files from.
+func native_operation_types() []string {
+	return []string{gnome_copied_files_type, kde_cut_selection_type}
+}
+
+func subscribe() (<-chan struct{}, func()) {
+	return linux_backend{}.Subscribe()
+}
+
+func read_text() (string, error)          { return linux_backend{}.ReadText() }
+func read_html() (string, error)          { return linux_backend{}.ReadHTML() }
+func read_image() ([]byte, error)         { return linux_backend{}.ReadImage() }
+func read_files() ([]string, error)       { return linux_backend{}.ReadFiles() }
+func write_text(text string) error        { return linux_backend{}.WriteText(text) }
+func write_html(text string) error        { return linux_backend{}.WriteHTML(text) }
+func write_image(data []byte) error       { return linux_backend{}.WriteImage(data) }
+func write_files(files []string) error    { return linux_backend{}.WriteFiles(files) }
+func read_all() ([]Representation, error) { return linux_backend{}.ReadAll() }
+func read_format(name string) ([]byte, error) {
+	return linux_backend{}.ReadFormat(name)
+}
+func write_all(items []Representation) error {
+	return linux_backend{}.WriteAll(items...)
+}
+func get_change_count() uint64                  { return linux_backend{}.ChangeCount() }
+func ownership_lost(seq uint64) <-chan struct{} { return linux_backend{}.lost(seq) }
+func get_content_types(params ContentTypeParams) ([]string, error) {
+	return linux_backend{}.ContentTypes(), nil
+}
+
+// linux_backend is one selection of the display server. The zero value
+// is the CLIPBOARD selection, which the package functions use.
+type linux_backend struct {
+	selection Selection
+	ctx       context.Context // nil for no deadline
+}
+
+func (l linux_backend) with_context(ctx context.Context) Backend {
+	l.ctx = ctx
+	return l
+}
+
+func (l linux_backend) name() string {
+	return native_name()
+}
+
+func (l linux_backend) operation_types() []string {
+	return native_operation_types()
+}
+
+func (l linux_backend) context() context.Context {
+	if l.ctx == nil {
+		return context.Background()
+	}
+	return l.ctx
+}
+
+func (l linux_backend) Subscribe() (<-chan struct{}, func()) {
+	x, err := open_board(l.selection)
+	if err != nil {
+		return nil, func() {}
+	}
+	return x.subscribe()
+}
+
+// linux_targets returns the targets, in order of preference, under which
+// the format called name is exchanged. They are X11 atom names, Wayland
+// clients offer them as MIME types as well.
+func linux_targets(name string) []string {
+	if f, ok := format.Lookup(name); ok && len(f.X11) > 0 {
+		return f.X11
+	}
+	return []string{name}
+}
+
+func (l linux_backend) ReadText() (string, error) {
+	x, err := open_board(l.selection)
+	if err != nil {
+		return "", err
+	}
+	for _, target := range linux_targets(TypeText) {
+		var data []byte
+		data, err = x.convert(l.context(), target)
+		if errors.Is(err, ErrFormatUnavailable) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if target == "STRING" {
+			return latin1_to_string(data), nil
+		}
+		return string(data), nil
+	}
+	return "", err
+}
+
+func (l linux_backend) ReadHTML() (string, error) {
+	x, err := open_board(l.selection)
+	if err != nil {
+		return "", err
+	}
+	data, err := x.convert(l.context(), linux_targets(TypeHTML)[0])
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (l linux_backend) ReadImage() ([]byte, error) {
+	x, err := open_board(l.selection)
+	if err != nil {
+		return nil, err
+	}
+	for i, target := range linux_targets(TypePNG) {
+		var data []byte
+		data, err = x.convert(l.context(), target)
+		if errors.Is(err, ErrFormatUnavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			return data, nil
+		}
+		return image_to_png(data)
+	}
+	return nil, err
+}
+
+func (l linux_backend) ReadFiles() ([]string, error) {
+	x, err := open_board(l.selection)
+	if err != nil {
+		return nil, err
+	}
+	data, err := x.convert(l.context(), linux_targets(TypeFiles)[0])
+	if err != nil {
+		return nil, err
+	}
+	files := urilist.Paths(data)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no files found", ErrFormatUnavailable)
+	}
+	return files, nil
+}
+
+func (l linux_backend) WriteText(text string) error {
+	return l.WriteAll(Representation{Type: TypeText, Data: []byte(text)})
+}
+
+func (l linux_backend) WriteHTML(text string) error {
+	return l.WriteAll(Representation{Type: TypeHTML, Data: []byte(text)})
+}
+
+func (l linux_backend) WriteImage(data []byte) error {
+	return l.WriteAll(Representation{Type: TypePNG, Data: data})
+}
+
+func (l linux_backend) WriteFiles(files []string) error {
+	return l.WriteAll(Representation{Type: TypeFiles, Data: []byte(strings.Join(files, "\n"))})
+}
+
+// WriteAll owns the selection once, serving every item under the
+// targets of its type.
+func (l linux_backend) WriteAll(items ...Representation) error {
+	x, err := open_board(l.selection)
+	if err != nil {
+		return err
+	}
+	values := map[string][]byte{}
+	for _, item := range items {
+		switch item.Type {
+		case TypeText:
+			for _, target := range linux_targets(TypeText) {
+				values[target] = item.Data
+			}
+			// STRING is Latin-1, it is left out for text beyond it.
+			if data, ok := string_to_latin1(string(item.Data)); ok {
+				values["STRING"] = data
+			} else {
+				delete(values, "STRING")
+			}
+		case TypePNG:
+			data := item.Data
+			if mimetype := http.DetectContentType(data); mimetype != "image/png" {
+				data, err = image_to_png(data)
+				if err != nil {
+					return err
+				}
+			}
+			values[linux_targets(TypePNG)[0]] = data
+		case TypeFiles:
+			data, err := urilist.FromPaths(strings.Split(string(item.Data), "\n"))
+			if err != nil {
+				return wrap(ErrInvalidContent, err)
+			}
+			values[linux_targets(TypeFiles)[0]] = data
+		default:
+			values[linux_targets(item.Type)[0]] = item.Data
+		}
+	}
+	return x.own(l.context(), values)
+}
+
+// ReadFormat reads the known types like their typed readers do, other
+// registered formats are converted to their first available target and
+// any other name is used as target.
+func (l linux_backend) ReadFormat(name string) ([]byte, error) {
+	switch name {
+	case TypeText:
+		text, err := l.ReadText()
+		return []byte(text), err
+	case TypeHTML:
+		html, err := l.ReadHTML()
+		return []byte(html), err
+	case TypePNG:
+		return l.ReadImage()
+	case TypeFiles:
+		files, err := l.ReadFiles()
+		return []byte(strings.Join(files, "\n")), err
+	}
+	x, err := open_board(l.selection)
+	if err != nil {
+		return nil, err
+	}
+	targets := linux_targets(name)
+	data, err := x.convert(l.context(), targets[0])
+	for _, target := range targets[1:] {
+		if err == nil {
+			break
+		}
+		data, err = x.convert(l.context(), target)
+	}
+	return data, err
+}
+
+// ReadAll reads the content as every type listed by ContentTypes.
+func (l linux_backend) ReadAll() ([]Representation, error) {
+	var items []Representation
+	types := l.ContentTypes()
+	for _, t := range types {
+		data, err := l.ReadFormat(t)
+		if errors.Is(err, ErrFormatUnavailable) {
+			// Listed but not convertible, such as TARGETS or MULTIPLE.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, Representation{Type: t, Data: data})
+	}
+	if ctx := l.context(); ctx.Err() != nil {
+		// Whatever was read is incomplete.
+		return nil, ctx_error(ctx)
+	}
+	if len(items) == 0 {
+		return nil, ErrEmpty
+	}
+	return items, nil
+}
+
+func (l linux_backend) ChangeCount() uint64 {
+	x, err := open_board(l.selection)
+	if err != nil {
+		return 0
+	}
+	return uint64(x.change_count())
+}
+
+// lost is told by the selection when content it owns is replaced, see
+// Ownership.
+func (l linux_backend) lost(seq uint64) <-chan struct{} {
+	x, err := open_board(l.selection)
+	if err != nil {
+		return nil
+	}
+	return x.lost(seq)
+}
+
+func (l linux_backend) ContentTypes() []string {
+	x, err := open_board(l.selection)
+	if err != nil {
+		return nil
+	}
+	targets, err := x.targets(l.context())
+	if err != nil {
+		return nil
+	}
+	var types []string
+	add := func(t string) {
+		for _, v := range types {
+			if v == t {
+				return
+			}
+		}
+		types = append(types, t)
+	}
+	for _, t := range targets {
+		switch t {
+		case "TARGETS", "TIMESTAMP", "MULTIPLE", "SAVE_TARGETS":
+			continue
+		}
+		if f, ok := format.FromX11(t); ok {
+			add(f.Name)
+		} else {
+			add(t)
+		}
+	}
+	return types
+}
+
+// string_to_latin1 returns s in Latin-1, false when s has characters
+// which Latin-1 lacks.
+func string_to_latin1(s string) ([]byte, bool) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, false
+		}
+		b = append(b, byte(r))
+	}
+	return b, true
+}
+
+func latin1_to_string(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
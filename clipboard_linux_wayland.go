@@ -0,0 +1,246 @@
+//go:build linux
+
+package clipboard
+
+// The Wayland backend uses the data-control protocols (see pkg/wayland),
+// core Wayland only lets the focused surface access the clipboard.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ltaoo/clipboard-go/pkg/wayland"
+)
+
+// How long to wait for the source client to write the selection.
+const wayland_timeout = 3 * time.Second
+
+type wayland_clipboard struct {
+	conn    *wayland.Conn
+	control *wayland.DataControl
+	primary bool // the primary selection instead of the clipboard
+
+	mu          sync.Mutex
+	offer       *wayland.DataOffer
+	source      *wayland.DataSource
+	owned       map[string][]byte
+	lost_ch     chan struct{} // closed when source is cancelled
+	count       int
+	subscribers map[chan struct{}]struct{}
+	finished    bool // the compositor invalidated the data device
+}
+
+// err_finished is returned once the compositor invalidated the data
+// device, usually because the seat went away.
+var err_finished = fmt.Errorf("%w: the compositor finished the data device", ErrSystem)
+
+// new_wayland_clipboard connects to display, accessing the primary
+// selection if primary is set.
+func new_wayland_clipboard(display string, primary bool) (*wayland_clipboard, error) {
+	conn, err := wayland.Dial(display)
+	if err != nil {
+		return nil, err
+	}
+	control, err := wayland.NewDataControl(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if primary && !control.Primary {
+		conn.Close()
+		return nil, fmt.Errorf("%w: the compositor does not support the primary selection", ErrUnsupportedPlatform)
+	}
+	w := &wayland_clipboard{
+		conn:        conn,
+		control:     control,
+		primary:     primary,
+		subscribers: map[chan struct{}]struct{}{},
+	}
+	if primary {
+		control.OnPrimarySelection = w.handle_selection
+	} else {
+		control.OnSelection = w.handle_selection
+	}
+	control.OnFinished = func() {
+		w.mu.Lock()
+		w.finished = true
+		w.mu.Unlock()
+		w.handle_selection(nil)
+	}
+	if err := control.Start(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Wait for the initial selection event.
+	if err := conn.Roundtrip(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *wayland_clipboard) handle_selection(offer *wayland.DataOffer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.offer != nil && w.offer != offer {
+		w.offer.Destroy(w.control)
+	}
+	w.offer = offer
+	w.count++
+	for ch := range w.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *wayland_clipboard) convert(ctx context.Context, target string) ([]byte, error) {
+	w.mu.Lock()
+	if w.finished {
+		w.mu.Unlock()
+		return nil, err_finished
+	}
+	if data, ok := w.owned[target]; ok {
+		w.mu.Unlock()
+		return data, nil
+	}
+	offer := w.offer
+	w.mu.Unlock()
+	if offer == nil {
+		return nil, ErrEmpty
+	}
+	available := false
+	for _, t := range offer.Types() {
+		if t == target {
+			available = true
+			break
+		}
+	}
+	if !available {
+		return nil, fmt.Errorf("%w: %v", ErrFormatUnavailable, target)
+	}
+	f, err := offer.Receive(target)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	f.SetReadDeadline(time.Now().Add(wayland_timeout))
+	// Interrupt the read once ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		f.SetReadDeadline(time.Now())
+	})
+	defer stop()
+	data, err := io.ReadAll(io.LimitReader(f, max_transfer+1))
+	if ctx.Err() != nil {
+		return nil, ctx_error(ctx)
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, fmt.Errorf("%w: timed out receiving the selection as %v", ErrBusy, target)
+	}
+	if len(data) > max_transfer {
+		return nil, ErrTooLarge
+	}
+	return data, err
+}
+
+// own ignores ctx, the compositor answers right away.
+func (w *wayland_clipboard) own(ctx context.Context, values map[string][]byte) error {
+	var types []string
+	for t := range values {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	var source *wayland.DataSource
+	lost := make(chan struct{})
+	send := func(mime_type string, f *os.File) {
+		data := values[mime_type]
+		// Writing may block until the receiver reads, keep it off the
+		// read goroutine.
+		go func() {
+			f.Write(data)
+			f.Close()
+		}()
+	}
+	cancelled := func() {
+		w.mu.Lock()
+		if w.source == source {
+			w.source = nil
+			w.owned = nil
+		}
+		w.mu.Unlock()
+		// The compositor cancels the source once another one, ours or
+		// not, replaces it.
+		close(lost)
+		source.Destroy()
+	}
+	w.mu.Lock()
+	if w.finished {
+		w.mu.Unlock()
+		return err_finished
+	}
+	source, err := w.control.CreateDataSource(types, send, cancelled)
+	if err != nil {
+		w.mu.Unlock()
+		return err
+	}
+	w.source = source
+	w.owned = values
+	w.lost_ch = lost
+	w.mu.Unlock()
+	set := w.control.SetSelection
+	if w.primary {
+		set = w.control.SetPrimarySelection
+	}
+	if err := set(source); err != nil {
+		return err
+	}
+	// The selection event for our own source bumps the change count.
+	return w.conn.Roundtrip()
+}
+
+func (w *wayland_clipboard) targets(ctx context.Context) ([]string, error) {
+	w.mu.Lock()
+	offer, finished := w.offer, w.finished
+	w.mu.Unlock()
+	if finished {
+		return nil, err_finished
+	}
+	if offer == nil {
+		return nil, nil
+	}
+	return offer.Types(), nil
+}
+
+func (w *wayland_clipboard) change_count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}
+
+func (w *wayland_clipboard) lost(seq uint64) <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.source == nil || uint64(w.count) != seq {
+		return closed_chan
+	}
+	return w.lost_ch
+}
+
+func (w *wayland_clipboard) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	w.subscribers[ch] = struct{}{}
+	w.mu.Unlock()
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.subscribers, ch)
+		w.mu.Unlock()
+	}
+}
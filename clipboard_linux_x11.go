@@ -0,0 +1,620 @@
+//go:build linux
+
+package clipboard
+
+// The X11 backend talks to the X server directly (see pkg/x11) and
+// implements the ICCCM selection protocol:
+// https://tronche.com/gui/x/icccm/sec-2.html
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ltaoo/clipboard-go/pkg/x11"
+)
+
+// How long to wait for the selection owner to answer a conversion.
+const x11_timeout = 3 * time.Second
+
+// Values larger than this are transferred with the INCR protocol.
+const x11_max_chunk = 1 << 18
+
+type x11_owned struct {
+	typ  uint32
+	data []byte
+}
+
+type x11_incr struct {
+	typ     uint32
+	data    []byte
+	started time.Time
+}
+
+type x11_incr_key struct {
+	requestor uint32
+	property  uint32
+}
+
+type x11_clipboard struct {
+	conn      *x11.Conn
+	window    uint32
+	selection uint32
+	// property on window that receives converted selections
+	property uint32
+	// property that is touched to obtain a server timestamp
+	time_property uint32
+
+	amu   sync.Mutex
+	atoms map[string]uint32
+	names map[uint32]string
+
+	// mu serializes conversions started by this client, replies are
+	// routed to notify and props by the event loop.
+	mu     sync.Mutex
+	notify chan *x11.SelectionNotifyEvent
+	props  chan *x11.PropertyNotifyEvent
+
+	omu        sync.Mutex
+	owned      map[uint32]x11_owned
+	owned_time uint32
+	lost_ch    chan struct{} // closed when owned is replaced
+	transfers  map[x11_incr_key]*x11_incr
+
+	cmu        sync.Mutex
+	last_owner uint32
+	count      int
+	// With XFixes the server reports owner changes, otherwise the owner
+	// is polled by change_count.
+	xfixes      bool
+	subscribers map[chan struct{}]struct{}
+}
+
+func new_x11_clipboard(display string, selection string) (*x11_clipboard, error) {
+	conn, err := x11.Dial(display)
+	if err != nil {
+		return nil, err
+	}
+	window, err := conn.CreateWindow(x11.PropertyChangeMask)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	x := &x11_clipboard{
+		conn:      conn,
+		window:    window,
+		atoms:     map[string]uint32{},
+		names:     map[uint32]string{},
+		notify:    make(chan *x11.SelectionNotifyEvent, 1),
+		props:     make(chan *x11.PropertyNotifyEvent, 64),
+		transfers: map[x11_incr_key]*x11_incr{},
+
+		subscribers: map[chan struct{}]struct{}{},
+	}
+	if x.selection, err = x.atom(selection); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if x.property, err = x.atom("_CLIPBOARD_GO_DATA"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if x.time_property, err = x.atom("_CLIPBOARD_GO_TIME"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	x.last_owner, _ = conn.GetSelectionOwner(x.selection)
+	xfixes, err := conn.XFixes()
+	if err == nil {
+		mask := uint32(x11.XFixesSetSelectionOwnerNotifyMask | x11.XFixesSelectionWindowDestroyNotifyMask | x11.XFixesSelectionClientCloseNotifyMask)
+		err = xfixes.SelectSelectionInput(window, x.selection, mask)
+	}
+	x.xfixes = err == nil
+	if !x.xfixes {
+		native_log().Debug("XFixes unavailable, polling the selection owner", "selection", selection, "error", err)
+	}
+	go x.event_loop()
+	return x, nil
+}
+
+func (x *x11_clipboard) atom(name string) (uint32, error) {
+	x.amu.Lock()
+	a, ok := x.atoms[name]
+	x.amu.Unlock()
+	if ok {
+		return a, nil
+	}
+	a, err := x.conn.InternAtom(name, false)
+	if err != nil {
+		return x11.None, err
+	}
+	x.amu.Lock()
+	x.atoms[name] = a
+	x.names[a] = name
+	x.amu.Unlock()
+	return a, nil
+}
+
+func (x *x11_clipboard) atom_name(a uint32) (string, error) {
+	x.amu.Lock()
+	name, ok := x.names[a]
+	x.amu.Unlock()
+	if ok {
+		return name, nil
+	}
+	name, err := x.conn.GetAtomName(a)
+	if err != nil {
+		return "", err
+	}
+	x.amu.Lock()
+	x.atoms[name] = a
+	x.names[a] = name
+	x.amu.Unlock()
+	return name, nil
+}
+
+func (x *x11_clipboard) event_loop() {
+	for {
+		ev, err := x.conn.WaitEvent()
+		if err != nil {
+			return
+		}
+		switch e := ev.(type) {
+		case *x11.SelectionRequestEvent:
+			x.handle_request(e)
+		case *x11.SelectionClearEvent:
+			x.handle_clear(e)
+		case *x11.XFixesSelectionNotifyEvent:
+			x.handle_owner_change(e)
+		case *x11.SelectionNotifyEvent:
+			if e.Requestor != x.window {
+				continue
+			}
+			// Only the latest answer matters, a stale one belongs to a
+			// conversion that already timed out.
+			select {
+			case <-x.notify:
+			default:
+			}
+			x.notify <- e
+		case *x11.PropertyNotifyEvent:
+			if e.Window == x.window {
+				select {
+				case x.props <- e:
+				default:
+				}
+				continue
+			}
+			x.handle_incr(e)
+		}
+	}
+}
+
+// server_time returns a timestamp from the X server, ICCCM forbids using
+// CurrentTime when acquiring a selection.
+func (x *x11_clipboard) server_time(ctx context.Context) (uint32, error) {
+	x.drain_props()
+	if err := x.conn.ChangeProperty(x11.PropModeAppend, x.window, x.time_property, x11.AtomInteger, 32, nil); err != nil {
+		return 0, err
+	}
+	timeout := time.After(x11_timeout)
+	for {
+		select {
+		case e := <-x.props:
+			if e.Atom == x.time_property {
+				return e.Time, nil
+			}
+		case <-timeout:
+			return 0, fmt.Errorf("%w: timed out waiting for the X server", ErrBusy)
+		case <-ctx.Done():
+			return 0, ctx_error(ctx)
+		}
+	}
+}
+
+func (x *x11_clipboard) drain_props() {
+	for {
+		select {
+		case <-x.props:
+		default:
+			return
+		}
+	}
+}
+
+// own takes ownership of the selection and serves values, which maps
+// target names to their data, until another client takes it over.
+func (x *x11_clipboard) own(ctx context.Context, values map[string][]byte) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	owned := map[uint32]x11_owned{}
+	for name, data := range values {
+		target, err := x.atom(name)
+		if err != nil {
+			return err
+		}
+		typ := target
+		if name == "TEXT" {
+			typ, err = x.atom("UTF8_STRING")
+			if err != nil {
+				return err
+			}
+		}
+		owned[target] = x11_owned{typ: typ, data: data}
+	}
+	t, err := x.server_time(ctx)
+	if err != nil {
+		return err
+	}
+	x.omu.Lock()
+	x.owned = owned
+	x.owned_time = t
+	// Owning the selection again sends no SelectionClear, the previous
+	// content is replaced all the same.
+	if x.lost_ch != nil {
+		close(x.lost_ch)
+	}
+	x.lost_ch = make(chan struct{})
+	x.omu.Unlock()
+	if err := x.conn.SetSelectionOwner(x.window, x.selection, t); err != nil {
+		return err
+	}
+	owner, err := x.conn.GetSelectionOwner(x.selection)
+	if err != nil {
+		return err
+	}
+	if owner != x.window {
+		return fmt.Errorf("%w: failed to acquire the selection", ErrBusy)
+	}
+	x.cmu.Lock()
+	x.last_owner = x.window
+	x.count++
+	x.notify_subscribers()
+	x.cmu.Unlock()
+	return nil
+}
+
+func (x *x11_clipboard) handle_clear(e *x11.SelectionClearEvent) {
+	if e.Selection != x.selection {
+		return
+	}
+	x.omu.Lock()
+	defer x.omu.Unlock()
+	if e.Time >= x.owned_time {
+		x.owned = nil
+		if x.lost_ch != nil {
+			close(x.lost_ch)
+			x.lost_ch = nil
+		}
+	}
+}
+
+func (x *x11_clipboard) handle_request(e *x11.SelectionRequestEvent) {
+	property := e.Property
+	if property == x11.None {
+		// Obsolete clients, see ICCCM 2.2.
+		property = e.Target
+	}
+	reply := &x11.SelectionNotifyEvent{
+		Time:      e.Time,
+		Requestor: e.Requestor,
+		Selection: e.Selection,
+		Target:    e.Target,
+		Property:  property,
+	}
+	if !x.serve(e, property) {
+		reply.Property = x11.None
+	}
+	x.conn.SendSelectionNotify(reply)
+}
+
+func (x *x11_clipboard) serve(e *x11.SelectionRequestEvent, property uint32) bool {
+	x.omu.Lock()
+	defer x.omu.Unlock()
+	if e.Selection != x.selection || x.owned == nil {
+		return false
+	}
+	if e.Time != x11.CurrentTime && e.Time < x.owned_time {
+		return false
+	}
+	targets, _ := x.atom("TARGETS")
+	timestamp, _ := x.atom("TIMESTAMP")
+	switch e.Target {
+	case targets:
+		list := []uint32{targets, timestamp}
+		for t := range x.owned {
+			list = append(list, t)
+		}
+		buf := make([]byte, 4*len(list))
+		for i, t := range list {
+			binary.LittleEndian.PutUint32(buf[4*i:], t)
+		}
+		return x.conn.ChangeProperty(x11.PropModeReplace, e.Requestor, property, x11.AtomAtom, 32, buf) == nil
+	case timestamp:
+		buf := binary.LittleEndian.AppendUint32(nil, x.owned_time)
+		return x.conn.ChangeProperty(x11.PropModeReplace, e.Requestor, property, x11.AtomInteger, 32, buf) == nil
+	}
+	v, ok := x.owned[e.Target]
+	if !ok {
+		return false
+	}
+	if len(v.data) <= x.chunk_size() {
+		return x.conn.ChangeProperty(x11.PropModeReplace, e.Requestor, property, v.typ, 8, v.data) == nil
+	}
+	// Too large for a single request, start an INCR transfer. The
+	// requestor deletes the property to ask for every next chunk.
+	incr, err := x.atom("INCR")
+	if err != nil {
+		return false
+	}
+	if err := x.conn.SelectInput(e.Requestor, x11.PropertyChangeMask); err != nil {
+		return false
+	}
+	size := binary.LittleEndian.AppendUint32(nil, uint32(len(v.data)))
+	if err := x.conn.ChangeProperty(x11.PropModeReplace, e.Requestor, property, incr, 32, size); err != nil {
+		return false
+	}
+	x.purge_transfers()
+	x.transfers[x11_incr_key{e.Requestor, property}] = &x11_incr{typ: v.typ, data: v.data, started: time.Now()}
+	return true
+}
+
+func (x *x11_clipboard) chunk_size() int {
+	n := x.conn.MaxPropertySize()
+	if n > x11_max_chunk {
+		n = x11_max_chunk
+	}
+	return n
+}
+
+// purge_transfers forgets INCR transfers whose requestor went away.
+// The caller must hold omu.
+func (x *x11_clipboard) purge_transfers() {
+	for k, t := range x.transfers {
+		if time.Since(t.started) > time.Minute {
+			delete(x.transfers, k)
+		}
+	}
+}
+
+func (x *x11_clipboard) handle_incr(e *x11.PropertyNotifyEvent) {
+	if e.State != x11.PropertyDelete {
+		return
+	}
+	x.omu.Lock()
+	defer x.omu.Unlock()
+	key := x11_incr_key{e.Window, e.Atom}
+	t, ok := x.transfers[key]
+	if !ok {
+		return
+	}
+	n := x.chunk_size()
+	if n > len(t.data) {
+		n = len(t.data)
+	}
+	chunk := t.data[:n]
+	t.data = t.data[n:]
+	x.conn.ChangeProperty(x11.PropModeReplace, e.Window, e.Atom, t.typ, 8, chunk)
+	if n == 0 {
+		// The zero length chunk marks the end of the transfer.
+		delete(x.transfers, key)
+		x.conn.SelectInput(e.Window, 0)
+	}
+}
+
+func (x *x11_clipboard) owned_value(target string) ([]byte, bool) {
+	a, err := x.atom(target)
+	if err != nil {
+		return nil, false
+	}
+	x.omu.Lock()
+	defer x.omu.Unlock()
+	if x.owned == nil {
+		return nil, false
+	}
+	v, ok := x.owned[a]
+	return v.data, ok
+}
+
+// convert asks the selection owner for target and returns the data. It
+// gives up when the owner does not answer within x11_timeout or ctx is
+// done.
+func (x *x11_clipboard) convert(ctx context.Context, target string) ([]byte, error) {
+	if data, ok := x.owned_value(target); ok {
+		return data, nil
+	}
+	a, err := x.atom(target)
+	if err != nil {
+		return nil, err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	owner, err := x.conn.GetSelectionOwner(x.selection)
+	if err != nil {
+		return nil, err
+	}
+	if owner == x11.None {
+		return nil, ErrEmpty
+	}
+	select {
+	case <-x.notify:
+	default:
+	}
+	x.conn.DeleteProperty(x.window, x.property)
+	if err := x.conn.ConvertSelection(x.window, x.selection, a, x.property, x11.CurrentTime); err != nil {
+		return nil, err
+	}
+	timeout := time.After(x11_timeout)
+	var e *x11.SelectionNotifyEvent
+	for e == nil {
+		select {
+		case n := <-x.notify:
+			if n.Selection == x.selection && n.Target == a {
+				e = n
+			}
+		case <-timeout:
+			return nil, fmt.Errorf("%w: timed out converting the selection to %v", ErrBusy, target)
+		case <-ctx.Done():
+			return nil, ctx_error(ctx)
+		}
+	}
+	if e.Property == x11.None {
+		return nil, fmt.Errorf("%w: %v", ErrFormatUnavailable, target)
+	}
+	data, typ, err := x.read_property(e.Property)
+	if err != nil {
+		return nil, err
+	}
+	incr, _ := x.atom("INCR")
+	if typ != incr {
+		return data, nil
+	}
+	return x.read_incr(ctx, e.Property)
+}
+
+// read_property reads and deletes property from our window. The server
+// only deletes it together with the last part of the value, so a chunk
+// written by an INCR owner in between is never lost.
+func (x *x11_clipboard) read_property(property uint32) ([]byte, uint32, error) {
+	var data []byte
+	var typ uint32
+	offset := uint32(0)
+	for {
+		r, err := x.conn.GetProperty(true, x.window, property, offset, 1<<20)
+		if err != nil {
+			return nil, x11.None, err
+		}
+		typ = r.Type
+		data = append(data, r.Value...)
+		offset += uint32(len(r.Value) / 4)
+		if r.BytesAfter == 0 {
+			break
+		}
+	}
+	return data, typ, nil
+}
+
+func (x *x11_clipboard) read_incr(ctx context.Context, property uint32) ([]byte, error) {
+	var data []byte
+	for {
+		timeout := time.After(x11_timeout)
+		var e *x11.PropertyNotifyEvent
+		for e == nil {
+			select {
+			case n := <-x.props:
+				if n.Atom == property && n.State == x11.PropertyNewValue {
+					e = n
+				}
+			case <-timeout:
+				return nil, fmt.Errorf("%w: timed out during INCR transfer", ErrBusy)
+			case <-ctx.Done():
+				return nil, ctx_error(ctx)
+			}
+		}
+		chunk, typ, err := x.read_property(property)
+		if err != nil {
+			return nil, err
+		}
+		if typ == x11.None {
+			// Notification for a property we already consumed.
+			continue
+		}
+		if len(chunk) == 0 {
+			return data, nil
+		}
+		if len(data)+len(chunk) > max_transfer {
+			return nil, ErrTooLarge
+		}
+		data = append(data, chunk...)
+	}
+}
+
+func (x *x11_clipboard) targets(ctx context.Context) ([]string, error) {
+	data, err := x.convert(ctx, "TARGETS")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for i := 0; i+4 <= len(data); i += 4 {
+		name, err := x.atom_name(binary.LittleEndian.Uint32(data[i:]))
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// change_count counts the owner changes. Without XFixes only a new owner
+// window is seen, content copied again from the window owning the
+// selection already is missed.
+func (x *x11_clipboard) change_count() int {
+	if x.xfixes {
+		x.cmu.Lock()
+		defer x.cmu.Unlock()
+		return x.count
+	}
+	owner, err := x.conn.GetSelectionOwner(x.selection)
+	x.cmu.Lock()
+	defer x.cmu.Unlock()
+	if err == nil && owner != x.last_owner {
+		x.last_owner = owner
+		x.count++
+	}
+	return x.count
+}
+
+// handle_owner_change counts the changes of the selection reported by
+// XFixes. Every new owner, even the previous one again, brings new
+// content. The changes made by own are counted there already.
+func (x *x11_clipboard) handle_owner_change(e *x11.XFixesSelectionNotifyEvent) {
+	if e.Selection != x.selection || e.Owner == x.window {
+		return
+	}
+	x.cmu.Lock()
+	defer x.cmu.Unlock()
+	x.last_owner = e.Owner
+	x.count++
+	x.notify_subscribers()
+}
+
+// notify_subscribers is called with cmu held.
+func (x *x11_clipboard) notify_subscribers() {
+	for ch := range x.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (x *x11_clipboard) lost(seq uint64) <-chan struct{} {
+	x.cmu.Lock()
+	count := x.count
+	x.cmu.Unlock()
+	x.omu.Lock()
+	defer x.omu.Unlock()
+	if x.lost_ch == nil || uint64(count) != seq {
+		return closed_chan
+	}
+	return x.lost_ch
+}
+
+// Without XFixes the core protocol has no change notification, the
+// selection owner is polled instead.
+func (x *x11_clipboard) subscribe() (<-chan struct{}, func()) {
+	if !x.xfixes {
+		return nil, func() {}
+	}
+	ch := make(chan struct{}, 1)
+	x.cmu.Lock()
+	x.subscribers[ch] = struct{}{}
+	x.cmu.Unlock()
+	return ch, func() {
+		x.cmu.Lock()
+		delete(x.subscribers, ch)
+		x.cmu.Unlock()
+	}
+}
@@ -0,0 +1,154 @@
+//go:build linux
+
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ltaoo/clipboard-go/pkg/x11/x11test"
+)
+
+func x11_server(t *testing.T, opts x11test.Options) *x11test.Server {
+	t.Helper()
+	t.Setenv("XAUTHORITY", t.TempDir()+"/none")
+	srv, err := x11test.NewServer(opts)
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func x11_board(t *testing.T, srv *x11test.Server) *x11_clipboard {
+	t.Helper()
+	x, err := new_x11_clipboard(srv.Display, "CLIPBOARD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { x.conn.Close() })
+	return x
+}
+
+func TestX11Convert(t *testing.T) {
+	srv := x11_server(t, x11test.Options{})
+	owner, requestor := x11_board(t, srv), x11_board(t, srv)
+	ctx := context.Background()
+	if _, err := requestor.convert(ctx, "UTF8_STRING"); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("convert without owner = %v", err)
+	}
+	if err := owner.own(ctx, map[string][]byte{"UTF8_STRING": []byte("hello"), "TEXT": []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Owner("CLIPBOARD") != owner.window {
+		t.Fatal("the selection is not owned")
+	}
+	if data, err := requestor.convert(ctx, "UTF8_STRING"); err != nil || string(data) != "hello" {
+		t.Errorf("convert = %q, %v", data, err)
+	}
+	if _, err := requestor.convert(ctx, "image/png"); !errors.Is(err, ErrFormatUnavailable) {
+		t.Errorf("convert(image/png) = %v", err)
+	}
+	targets, err := requestor.targets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"TARGETS", "TIMESTAMP", "UTF8_STRING", "TEXT"} {
+		if !slices.Contains(targets, want) {
+			t.Errorf("targets = %q, lacking %v", targets, want)
+		}
+	}
+	// TEXT is answered as UTF8_STRING, the owner chooses the encoding.
+	text, _ := requestor.atom("TEXT")
+	utf8_string, _ := requestor.atom("UTF8_STRING")
+	for _, req := range srv.Requests() {
+		if req[0] == 18 && binary.LittleEndian.Uint32(req[4:]) == requestor.window && binary.LittleEndian.Uint32(req[12:]) == text {
+			t.Errorf("TEXT served as type TEXT, want %v", utf8_string)
+		}
+	}
+}
+
+func TestX11Incr(t *testing.T) {
+	srv := x11_server(t, x11test.Options{MaxRequestLength: 4096})
+	owner, requestor := x11_board(t, srv), x11_board(t, srv)
+	ctx := context.Background()
+	data := make([]byte, 3*owner.chunk_size()+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := owner.own(ctx, map[string][]byte{"image/png": data}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := requestor.convert(ctx, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("convert = %d bytes, want %d", len(got), len(data))
+	}
+	// The owner announces the size with INCR, then writes the chunks and
+	// an empty one ending the transfer.
+	incr, _ := owner.atom("INCR")
+	var sizes []int
+	for _, req := range srv.Requests() {
+		if req[0] != 18 || binary.LittleEndian.Uint32(req[4:]) != requestor.window || binary.LittleEndian.Uint32(req[8:]) != requestor.property {
+			continue
+		}
+		if binary.LittleEndian.Uint32(req[12:]) == incr {
+			if size := binary.LittleEndian.Uint32(req[24:]); int(size) != len(data) {
+				t.Errorf("INCR size = %d, want %d", size, len(data))
+			}
+			continue
+		}
+		sizes = append(sizes, int(binary.LittleEndian.Uint32(req[20:])))
+	}
+	n := owner.chunk_size()
+	if want := []int{n, n, n, 100, 0}; !slices.Equal(sizes, want) {
+		t.Errorf("chunks = %v, want %v", sizes, want)
+	}
+	owner.omu.Lock()
+	left := len(owner.transfers)
+	owner.omu.Unlock()
+	if left != 0 {
+		t.Errorf("%d transfers left", left)
+	}
+}
+
+func TestX11OwnerChange(t *testing.T) {
+	for _, xfixes := range []bool{false, true} {
+		srv := x11_server(t, x11test.Options{XFixes: xfixes})
+		a, b := x11_board(t, srv), x11_board(t, srv)
+		if a.xfixes != xfixes {
+			t.Fatalf("xfixes = %v, want %v", a.xfixes, xfixes)
+		}
+		ctx := context.Background()
+		if err := a.own(ctx, map[string][]byte{"UTF8_STRING": []byte("a")}); err != nil {
+			t.Fatal(err)
+		}
+		lost := a.lost(uint64(a.change_count()))
+		count := a.change_count()
+		if err := b.own(ctx, map[string][]byte{"UTF8_STRING": []byte("b")}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-lost:
+		case <-time.After(time.Second):
+			t.Errorf("xfixes %v: ownership not lost", xfixes)
+		}
+		deadline := time.Now().Add(time.Second)
+		for a.change_count() == count && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if a.change_count() == count {
+			t.Errorf("xfixes %v: change not seen", xfixes)
+		}
+		if data, err := a.convert(ctx, "UTF8_STRING"); err != nil || string(data) != "b" {
+			t.Errorf("xfixes %v: convert = %q, %v", xfixes, data, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package clipboard_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ltaoo/clipboard-go"
+	"github.com/ltaoo/clipboard-go/clipboardtest"
+)
+
+// polled hides the change notification of the fake, like the macOS
+// backend.
+type polled struct {
+	*clipboardtest.Backend
+}
+
+func (polled) Subscribe() (<-chan struct{}, func()) {
+	return nil, func() {}
+}
+
+func TestWaitForChange(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		fake := clipboardtest.New()
+		var b clipboard.Backend = fake
+		if poll {
+			b = polled{fake}
+		}
+		c := clipboard.New(b)
+		since := c.ChangeCount()
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			fake.Set(clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte("a")})
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		count, err := c.WaitForChange(ctx, since)
+		cancel()
+		if err != nil || count != since+1 {
+			t.Errorf("poll %v: WaitForChange = %d, %v, want %d", poll, count, err, since+1)
+		}
+		// A change made before the call is reported right away.
+		if count, err := c.WaitForChange(context.Background(), since); err != nil || count != since+1 {
+			t.Errorf("poll %v: WaitForChange after the change = %d, %v", poll, count, err)
+		}
+	}
+}
+
+func TestWaitForChangeCanceled(t *testing.T) {
+	c := clipboard.New(clipboardtest.New())
+	since := c.ChangeCount()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	count, err := c.WaitForChange(ctx, since)
+	if !errors.Is(err, context.DeadlineExceeded) || count != since {
+		t.Errorf("WaitForChange = %d, %v, want %d, %v", count, err, since, context.DeadlineExceeded)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.WaitForChange(ctx, since); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitForChange with a canceled context = %v", err)
+	}
+}
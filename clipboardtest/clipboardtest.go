@@ -0,0 +1,198 @@
+// Package clipboardtest provides an in-memory clipboard for tests of
+// code that uses the clipboard package, so they run without a desktop:
+//
+//	fake := clipboardtest.New()
+//	clipboard.Use(fake)
+//	defer clipboard.Use(nil)
+//
+//	fake.Set(clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte("copied elsewhere")})
+//	text, _ := clipboard.ReadText()
+package clipboardtest
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ltaoo/clipboard-go"
+	"github.com/ltaoo/clipboard-go/pkg/format"
+)
+
+// Types understood by the typed Read and Write methods. Any other type
+// can be stored with Set and is listed by ContentTypes.
+const (
+	TypeText  = clipboard.TypeText
+	TypeHTML  = clipboard.TypeHTML
+	TypePNG   = clipboard.TypePNG
+	TypeFiles = clipboard.TypeFiles
+)
+
+// ErrUnavailable is returned when the clipboard holds no data of the
+// requested type, like by the system backends. An empty clipboard
+// returns clipboard.ErrEmpty.
+var ErrUnavailable = clipboard.ErrFormatUnavailable
+
+// Item is one representation of the clipboard content. Files are stored
+// as newline separated paths.
+type Item = clipboard.Representation
+
+// Backend is an in-memory clipboard.Backend. It is safe for concurrent
+// use; the zero value is not, use New.
+type Backend struct {
+	mu          sync.Mutex
+	items       []Item
+	count       uint64
+	subscribers map[chan struct{}]struct{}
+}
+
+var _ clipboard.Backend = (*Backend)(nil)
+
+// New returns an empty clipboard.
+func New() *Backend {
+	return &Backend{subscribers: map[chan struct{}]struct{}{}}
+}
+
+// Set replaces the content with items, as if another application had
+// copied them, and notifies watchers.
+func (b *Backend) Set(items ...Item) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.items = nil
+	for _, item := range items {
+		b.items = append(b.items, Item{Type: item.Type, Data: append([]byte(nil), item.Data...)})
+	}
+	b.count++
+	for ch := range b.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Clear empties the clipboard.
+func (b *Backend) Clear() {
+	b.Set()
+}
+
+// Items returns a copy of the current content.
+func (b *Backend) Items() []Item {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	items := make([]Item, len(b.items))
+	for i, item := range b.items {
+		items[i] = Item{Type: item.Type, Data: append([]byte(nil), item.Data...)}
+	}
+	return items
+}
+
+// Get returns the data stored as typ. Types are matched by their
+// canonical name, so that "UTF8_STRING" finds the data stored as
+// TypeText and the other way round, see format.Canonical.
+func (b *Backend) Get(typ string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.items) == 0 {
+		return nil, clipboard.ErrEmpty
+	}
+	typ = format.Canonical(typ)
+	for _, item := range b.items {
+		if format.Canonical(item.Type) == typ {
+			return append([]byte(nil), item.Data...), nil
+		}
+	}
+	return nil, ErrUnavailable
+}
+
+func (b *Backend) ReadText() (string, error) {
+	data, err := b.Get(TypeText)
+	return string(data), err
+}
+
+func (b *Backend) ReadHTML() (string, error) {
+	data, err := b.Get(TypeHTML)
+	return string(data), err
+}
+
+func (b *Backend) ReadImage() ([]byte, error) {
+	return b.Get(TypePNG)
+}
+
+func (b *Backend) ReadFiles() ([]string, error) {
+	data, err := b.Get(TypeFiles)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(string(data), "\n") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (b *Backend) WriteText(text string) error {
+	b.Set(Item{Type: TypeText, Data: []byte(text)})
+	return nil
+}
+
+func (b *Backend) WriteHTML(html string) error {
+	b.Set(Item{Type: TypeHTML, Data: []byte(html)})
+	return nil
+}
+
+func (b *Backend) WriteImage(data []byte) error {
+	b.Set(Item{Type: TypePNG, Data: data})
+	return nil
+}
+
+func (b *Backend) WriteFiles(files []string) error {
+	b.Set(Item{Type: TypeFiles, Data: []byte(strings.Join(files, "\n"))})
+	return nil
+}
+
+func (b *Backend) ReadFormat(name string) ([]byte, error) {
+	return b.Get(name)
+}
+
+func (b *Backend) ReadAll() ([]clipboard.Representation, error) {
+	items := b.Items()
+	if len(items) == 0 {
+		return nil, clipboard.ErrEmpty
+	}
+	return items, nil
+}
+
+func (b *Backend) WriteAll(items ...clipboard.Representation) error {
+	b.Set(items...)
+	return nil
+}
+
+func (b *Backend) ContentTypes() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var types []string
+	for _, item := range b.items {
+		types = append(types, item.Type)
+	}
+	return types
+}
+
+func (b *Backend) ChangeCount() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count
+}
+
+// Subscribe returns a channel signalled after every change.
+func (b *Backend) Subscribe() (<-chan struct{}, func()) {
+	changed := make(chan struct{}, 1)
+	b.mu.Lock()
+	b.subscribers[changed] = struct{}{}
+	b.mu.Unlock()
+	return changed, func() {
+		b.mu.Lock()
+		delete(b.subscribers, changed)
+		b.mu.Unlock()
+	}
+}
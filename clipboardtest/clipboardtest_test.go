@@ -0,0 +1,70 @@
+package clipboardtest
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ltaoo/clipboard-go"
+)
+
+func TestGetCanonical(t *testing.T) {
+	b := New()
+	b.Set(
+		Item{Type: "UTF8_STRING", Data: []byte("text")},
+		Item{Type: "public.html", Data: []byte("<b>html</b>")},
+		Item{Type: "application/x-myapp", Data: []byte("private")},
+	)
+	for _, c := range []struct{ typ, want string }{
+		{TypeText, "text"},
+		{"text/plain", "text"},
+		{"CF_UNICODETEXT", "text"},
+		{TypeHTML, "<b>html</b>"},
+		{"HTML Format", "<b>html</b>"},
+		{"TEXT/HTML", "<b>html</b>"},
+		{"application/x-myapp", "private"},
+	} {
+		if data, err := b.Get(c.typ); err != nil || string(data) != c.want {
+			t.Errorf("Get(%q) = %q, %v, want %q", c.typ, data, err, c.want)
+		}
+	}
+	if text, err := b.ReadText(); err != nil || text != "text" {
+		t.Errorf("ReadText = %q, %v", text, err)
+	}
+	if _, err := b.Get(TypePNG); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Get(TypePNG) = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestBackend(t *testing.T) {
+	b := New()
+	changed, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	if _, err := b.ReadText(); !errors.Is(err, clipboard.ErrEmpty) {
+		t.Errorf("ReadText of an empty clipboard = %v", err)
+	}
+	if _, err := b.ReadAll(); !errors.Is(err, clipboard.ErrEmpty) {
+		t.Errorf("ReadAll of an empty clipboard = %v", err)
+	}
+	if err := b.WriteFiles([]string{"/a", "", "/b"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("no change signalled")
+	}
+	if b.ChangeCount() != 1 {
+		t.Errorf("ChangeCount = %d, want 1", b.ChangeCount())
+	}
+	if files, err := b.ReadFiles(); err != nil || !slices.Equal(files, []string{"/a", "/b"}) {
+		t.Errorf("ReadFiles = %q, %v", files, err)
+	}
+	if types := b.ContentTypes(); !slices.Equal(types, []string{TypeFiles}) {
+		t.Errorf("ContentTypes = %q", types)
+	}
+	b.Clear()
+	if b.ChangeCount() != 2 || len(b.Items()) != 0 {
+		t.Errorf("after Clear: ChangeCount = %d, %d items", b.ChangeCount(), len(b.Items()))
+	}
+}
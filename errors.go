@@ -0,0 +1,44 @@
+package clipboard
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors of the backends. They wrap the native error which caused them,
+// if any, so test for them with errors.Is:
+//
+//	text, err := clipboard.ReadText()
+//	if errors.Is(err, clipboard.ErrEmpty) {
+//		// nothing copied
+//	}
+var (
+	// ErrEmpty means nothing is on the clipboard.
+	ErrEmpty = errors.New("clipboard is empty")
+	// ErrFormatUnavailable means the content is not available in the
+	// requested format.
+	ErrFormatUnavailable = errors.New("clipboard format not available")
+	// ErrBusy means the clipboard is held by another application, or
+	// the application owning the content does not answer.
+	ErrBusy = errors.New("clipboard is busy")
+	// ErrUnsupportedPlatform means the system lacks the requested
+	// feature, such as the primary selection on Windows.
+	ErrUnsupportedPlatform = errors.New("not supported on this platform")
+	// ErrTooLarge means the content is too large to be transferred.
+	ErrTooLarge = errors.New("clipboard content too large")
+	// ErrInvalidContent means the content to write cannot be put on the
+	// clipboard, such as an image of an unknown format or a list of
+	// files without a usable path.
+	ErrInvalidContent = errors.New("invalid clipboard content")
+	// ErrSystem means a call of the system clipboard failed without a
+	// more specific reason.
+	ErrSystem = errors.New("clipboard system call failed")
+)
+
+// wrap returns kind, wrapping the native error err when there is one.
+func wrap(kind error, err error) error {
+	if err == nil {
+		return kind
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
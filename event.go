@@ -0,0 +1,181 @@
+package clipboard
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrChanged is returned by the accessors of an Event when the clipboard
+// content changed again before they were called.
+var ErrChanged = errors.New("clipboard changed since the event")
+
+// Event is a change of the clipboard content. Its data is only read from
+// the clipboard when an accessor is called, and cached afterwards.
+type Event struct {
+	// Seq is the change count of the clipboard after the change.
+	Seq uint64
+	// Time is when the change was noticed.
+	Time time.Time
+	// Selection is the selection that changed.
+	Selection Selection
+	// Formats lists the types of the new content, see ContentTypes.
+	Formats []string
+	// Writer is the Clipboard of this process whose write made the
+	// change, nil when another application made it.
+	Writer *Clipboard
+
+	backend Backend
+	mu      sync.Mutex
+	cache   map[string]event_data
+}
+
+type event_data struct {
+	data interface{}
+	err  error
+}
+
+func new_event(b Backend, seq uint64, s Selection) *Event {
+	return &Event{
+		Seq:       seq,
+		Time:      time.Now(),
+		Selection: s,
+		Formats:   b.ContentTypes(),
+		backend:   b,
+		cache:     map[string]event_data{},
+	}
+}
+
+func (e *Event) has_any(names []string) bool {
+	for _, name := range names {
+		if e.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether the content is available as type name.
+func (e *Event) Has(name string) bool {
+	return has_type(e.Formats, name)
+}
+
+func has_type(types []string, name string) bool {
+	for _, t := range types {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Text returns the content as plain text.
+func (e *Event) Text() (string, error) {
+	v, err := e.load(TypeText, func() (interface{}, error) { return e.backend.ReadText() })
+	text, _ := v.(string)
+	return text, err
+}
+
+// HTML returns the content as HTML.
+func (e *Event) HTML() (string, error) {
+	v, err := e.load(TypeHTML, func() (interface{}, error) { return e.backend.ReadHTML() })
+	html, _ := v.(string)
+	return html, err
+}
+
+// Image returns the content as PNG encoded image.
+func (e *Event) Image() ([]byte, error) {
+	v, err := e.load(TypePNG, func() (interface{}, error) { return e.backend.ReadImage() })
+	data, _ := v.([]byte)
+	return data, err
+}
+
+// Files returns the paths of the copied files.
+func (e *Event) Files() ([]string, error) {
+	v, err := e.load(TypeFiles, func() (interface{}, error) { return e.backend.ReadFiles() })
+	files, _ := v.([]string)
+	return files, err
+}
+
+// Data returns the content as type name, like ReadFormat.
+func (e *Event) Data(name string) ([]byte, error) {
+	v, err := e.load("format:"+name, func() (interface{}, error) { return e.backend.ReadFormat(name) })
+	data, _ := v.([]byte)
+	return data, err
+}
+
+// digest hashes the data of the types of e in names, of every type if
+// names is empty. Types which cannot be read, such as the GDI handles
+// Office puts on the Windows clipboard, are left out. ok is false if e
+// has none of the others.
+func (e *Event) digest(names []string) (sum [sha256.Size]byte, ok bool, err error) {
+	h := sha256.New()
+	for _, t := range e.Formats {
+		if len(names) > 0 && !has_type(names, t) {
+			continue
+		}
+		data, err := e.Data(t)
+		if errors.Is(err, ErrChanged) {
+			return sum, false, err
+		}
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", t, len(data))
+		h.Write(data)
+		ok = true
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, ok, nil
+}
+
+func (e *Event) load(key string, read func() (interface{}, error)) (interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if d, ok := e.cache[key]; ok {
+		return d.data, d.err
+	}
+	data, err := read()
+	if e.backend.ChangeCount() != e.Seq {
+		// What was read, or failed to, may be the next content.
+		data, err = nil, ErrChanged
+	}
+	e.cache[key] = event_data{data: data, err: err}
+	return data, err
+}
+
+// content loads the richest type of the event the way Watch always
+// reported it.
+func (e *Event) content() ClipboardContent {
+	c := ClipboardContent{Selection: e.Selection}
+	switch {
+	case e.Has(TypeFiles):
+		c.Type = TypeFiles
+		c.Data, c.Error = e.Files()
+	case e.Has(TypePNG):
+		c.Type = TypePNG
+		c.Data, c.Error = e.Image()
+	case e.Has(TypeHTML):
+		c.Type = TypeHTML
+		c.Data, c.Error = e.HTML()
+	case e.Has(TypeText):
+		c.Type = TypeText
+		c.Data, c.Error = e.Text()
+	case len(e.Formats) == 0:
+		c.Error = ErrEmpty
+	default:
+		c.Type = strings.Join(e.Formats, "\n")
+		c.Error = fmt.Errorf("%w: no content of a known type", ErrFormatUnavailable)
+	}
+	return c
+}
+
+// Events returns a channel receiving an Event after every change of the
+// clipboard, it is closed once ctx is canceled.
+func Events(ctx context.Context) <-chan *Event {
+	return std.Events(ctx)
+}
@@ -4,7 +4,4 @@ go 1.24
 
 toolchain go1.24.6
 
-require (
-	github.com/ebitengine/purego v0.8.4
-	golang.org/x/image v0.28.0
-)
+require github.com/ebitengine/purego v0.8.4
@@ -0,0 +1,36 @@
+package clipboard
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"github.com/ltaoo/clipboard-go/pkg/dib"
+)
+
+// image_to_png converts a JPEG or BMP image to PNG, for the systems
+// exchanging images as PNG only.
+func image_to_png(data []byte) ([]byte, error) {
+	var img image.Image
+	var err error
+	switch mimetype := http.DetectContentType(data); mimetype {
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/bmp":
+		// Keeps the alpha channel of 32 bit bitmaps.
+		img, err = dib.DecodeBMP(data)
+	default:
+		return nil, fmt.Errorf("%w: unsupported image type %v", ErrFormatUnavailable, mimetype)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
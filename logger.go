@@ -0,0 +1,139 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Option configures a Clipboard created with New.
+type Option func(c *Clipboard)
+
+// WithLogger makes the Clipboard log its operations to l, see
+// SetLogger.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Clipboard) {
+		c.logger = l
+	}
+}
+
+// WithRetryPolicy sets how operations are retried while the clipboard
+// is busy, see SetRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Clipboard) {
+		c.retry = &p
+	}
+}
+
+// The logger set with SetLogger, nil while nothing is logged.
+var logger atomic.Pointer[slog.Logger]
+
+var discard = slog.New(slog.DiscardHandler)
+
+// SetLogger makes the package log to l: the operations of every
+// Clipboard without a logger of its own, at level Debug when they
+// succeed, and the diagnostics of the system backends. Records carry the
+// backend, the format, the size of the data and the duration. Nothing is
+// logged by default, SetLogger(nil) turns logging off again.
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// SetLogger makes c log its operations to l, or to the logger of the
+// package when l is nil.
+func (c *Clipboard) SetLogger(l *slog.Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logger = l
+}
+
+// native_log returns the logger for the diagnostics of the system
+// backends.
+func native_log() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l.With("backend", native_name())
+	}
+	return discard
+}
+
+// log returns the logger of c, which discards everything when none is
+// set.
+func (c *Clipboard) log() *slog.Logger {
+	c.mu.Lock()
+	l := c.logger
+	c.mu.Unlock()
+	if l == nil {
+		l = logger.Load()
+	}
+	if l == nil {
+		return discard
+	}
+	return l
+}
+
+// named_backend is implemented by the system backends.
+type named_backend interface {
+	name() string
+}
+
+func (native_backend) name() string {
+	return native_name()
+}
+
+// backend_name names b in log records.
+func backend_name(b Backend) string {
+	if n, ok := b.(named_backend); ok {
+		return n.name()
+	}
+	return fmt.Sprintf("%T", b)
+}
+
+// log_op logs an operation on the clipboard which took since start, at
+// a level depending on how it failed.
+func log_op(ctx context.Context, l *slog.Logger, b Backend, op string, name string, size int, start time.Time, err error) {
+	level := slog.LevelDebug
+	switch {
+	case err == nil,
+		errors.Is(err, ErrEmpty),
+		errors.Is(err, ErrFormatUnavailable),
+		errors.Is(err, context.Canceled):
+	case errors.Is(err, ErrBusy):
+		level = slog.LevelWarn
+	default:
+		level = slog.LevelError
+	}
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("backend", backend_name(b)),
+		slog.String("format", name),
+		slog.Int("size", size),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	l.LogAttrs(ctx, level, "clipboard "+op, attrs...)
+}
+
+// item_types joins the types of items for log records.
+func item_types(items []Representation) string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Type
+	}
+	return strings.Join(names, ",")
+}
+
+func total_size(items []Representation) int {
+	n := 0
+	for _, item := range items {
+		n += len(item.Data)
+	}
+	return n
+}
@@ -0,0 +1,214 @@
+package clipboard
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/ltaoo/clipboard-go/pkg/urilist"
+)
+
+// FileOperation tells file managers what pasting copied files does with
+// them.
+type FileOperation int
+
+const (
+	// OpCopy copies the files, what WriteFiles asks for.
+	OpCopy FileOperation = iota
+	// OpCut moves the files.
+	OpCut
+	// OpLink creates links to the files, only Windows knows it, GNOME
+	// and KDE copy the files instead.
+	OpLink
+)
+
+func (op FileOperation) String() string {
+	switch op {
+	case OpCopy:
+		return "copy"
+	case OpCut:
+		return "cut"
+	case OpLink:
+		return "link"
+	}
+	return "unknown"
+}
+
+// Formats the operation is written in besides the files.
+const (
+	// "Preferred DropEffect" of Windows Explorer, a DWORD of DROPEFFECT
+	// flags.
+	drop_effect_type = "Preferred DropEffect"
+	// x-special/gnome-copied-files of Nautilus and other GTK file
+	// managers, "copy" or "cut" followed by one URI per line.
+	gnome_copied_files_type = "x-special/gnome-copied-files"
+	// application/x-kde-cutselection of Dolphin, "1" when the files are
+	// cut.
+	kde_cut_selection_type = "application/x-kde-cutselection"
+)
+
+// DROPEFFECT flags.
+const (
+	dropeffect_copy = 1
+	dropeffect_move = 2
+	dropeffect_link = 4
+)
+
+// operation_backend is implemented by the system backends, which only
+// write the operation in the formats of their system. The others write
+// all of them.
+type operation_backend interface {
+	operation_types() []string
+}
+
+func (native_backend) operation_types() []string {
+	return native_operation_types()
+}
+
+func operation_types(b Backend) []string {
+	if o, ok := b.(operation_backend); ok {
+		return o.operation_types()
+	}
+	return []string{drop_effect_type, gnome_copied_files_type, kde_cut_selection_type}
+}
+
+// operation_items returns the representations of files to paste with
+// op, in the formats of types.
+func operation_items(files []string, op FileOperation, types []string) ([]Representation, error) {
+	items := []Representation{{Type: TypeFiles, Data: []byte(strings.Join(files, "\n"))}}
+	for _, t := range types {
+		switch t {
+		case drop_effect_type:
+			effect := uint32(dropeffect_copy)
+			switch op {
+			case OpCut:
+				effect = dropeffect_move
+			case OpLink:
+				effect = dropeffect_link
+			}
+			items = append(items, Representation{Type: t, Data: binary.LittleEndian.AppendUint32(nil, effect)})
+		case gnome_copied_files_type:
+			verb := "copy"
+			if op == OpCut {
+				verb = "cut"
+			}
+			lines := []string{verb}
+			for _, f := range files {
+				if f == "" {
+					continue
+				}
+				uri, err := urilist.FromPath(f)
+				if err != nil {
+					return nil, wrap(ErrInvalidContent, err)
+				}
+				lines = append(lines, uri)
+			}
+			items = append(items, Representation{Type: t, Data: []byte(strings.Join(lines, "\n"))})
+		case kde_cut_selection_type:
+			if op == OpCut {
+				items = append(items, Representation{Type: t, Data: []byte("1")})
+			}
+		}
+	}
+	return items, nil
+}
+
+// read_operation returns the operation files on the clipboard of b are
+// to be pasted with, OpCopy unless one of types tells otherwise.
+func read_operation(b Backend, types []string) (FileOperation, error) {
+	for _, t := range types {
+		data, err := b.ReadFormat(t)
+		if errors.Is(err, ErrBusy) || errors.Is(err, context.Canceled) {
+			return OpCopy, err
+		}
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		switch t {
+		case drop_effect_type:
+			if len(data) < 4 {
+				continue
+			}
+			effect := binary.LittleEndian.Uint32(data)
+			// Explorer sets the copy flag along with the others when
+			// both are allowed, a move is only asked for without it.
+			switch {
+			case effect&dropeffect_move != 0 && effect&dropeffect_copy == 0:
+				return OpCut, nil
+			case effect&dropeffect_link != 0 && effect&dropeffect_copy == 0:
+				return OpLink, nil
+			}
+			return OpCopy, nil
+		case gnome_copied_files_type:
+			verb, _, _ := strings.Cut(string(data), "\n")
+			switch strings.TrimSpace(verb) {
+			case "cut":
+				return OpCut, nil
+			case "link":
+				return OpLink, nil
+			}
+			return OpCopy, nil
+		case kde_cut_selection_type:
+			if strings.TrimSpace(string(data)) == "1" {
+				return OpCut, nil
+			}
+		}
+	}
+	return OpCopy, nil
+}
+
+// WriteFilesWithOperation puts files on c like WriteFiles, telling file
+// managers to paste them with op: Explorer by "Preferred DropEffect",
+// Nautilus by x-special/gnome-copied-files and Dolphin by
+// application/x-kde-cutselection. macOS has no such format, Finder
+// decides on pasting.
+func (c *Clipboard) WriteFilesWithOperation(files []string, op FileOperation) (*Ownership, error) {
+	return c.WriteFilesWithOperationContext(context.Background(), files, op)
+}
+
+// WriteFilesWithOperationContext is WriteFilesWithOperation giving up
+// once ctx is done.
+func (c *Clipboard) WriteFilesWithOperationContext(ctx context.Context, files []string, op FileOperation) (*Ownership, error) {
+	return c.wrote(c.do(ctx, "write", TypeFiles, func(b Backend) (int, error) {
+		items, err := operation_items(files, op, operation_types(b))
+		if err != nil {
+			return 0, err
+		}
+		return len(files), b.WriteAll(items...)
+	}))
+}
+
+// ReadFilesWithOperation returns the files on c like ReadFiles, and
+// the operation they are to be pasted with, OpCopy when the application
+// which put them did not tell.
+func (c *Clipboard) ReadFilesWithOperation() ([]string, FileOperation, error) {
+	return c.ReadFilesWithOperationContext(context.Background())
+}
+
+// ReadFilesWithOperationContext is ReadFilesWithOperation giving up
+// once ctx is done.
+func (c *Clipboard) ReadFilesWithOperationContext(ctx context.Context) (files []string, op FileOperation, err error) {
+	_, err = c.do(ctx, "read", TypeFiles, func(b Backend) (_ int, err error) {
+		files, err = b.ReadFiles()
+		if err != nil {
+			return 0, err
+		}
+		op, err = read_operation(b, operation_types(b))
+		return len(files), err
+	})
+	return files, op, err
+}
+
+func WriteFilesWithOperation(files []string, op FileOperation) (*Ownership, error) {
+	return std.WriteFilesWithOperation(files, op)
+}
+func WriteFilesWithOperationContext(ctx context.Context, files []string, op FileOperation) (*Ownership, error) {
+	return std.WriteFilesWithOperationContext(ctx, files, op)
+}
+func ReadFilesWithOperation() ([]string, FileOperation, error) {
+	return std.ReadFilesWithOperation()
+}
+func ReadFilesWithOperationContext(ctx context.Context) ([]string, FileOperation, error) {
+	return std.ReadFilesWithOperationContext(ctx)
+}
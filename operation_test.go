@@ -0,0 +1,58 @@
+package clipboard_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/ltaoo/clipboard-go"
+	"github.com/ltaoo/clipboard-go/clipboardtest"
+)
+
+func TestFileOperationRoundTrip(t *testing.T) {
+	files := []string{"/home/me/My Documents/a b.txt", "/tmp/c.txt"}
+	const uris = "file:///home/me/My%20Documents/a%20b.txt\nfile:///tmp/c.txt"
+	for _, c := range []struct {
+		encoding string
+		op       clipboard.FileOperation
+		data     []byte // nil when the operation is not written
+		read     clipboard.FileOperation
+	}{
+		{"Preferred DropEffect", clipboard.OpCopy, []byte{1, 0, 0, 0}, clipboard.OpCopy},
+		{"Preferred DropEffect", clipboard.OpCut, []byte{2, 0, 0, 0}, clipboard.OpCut},
+		{"Preferred DropEffect", clipboard.OpLink, []byte{4, 0, 0, 0}, clipboard.OpLink},
+		{"x-special/gnome-copied-files", clipboard.OpCopy, []byte("copy\n" + uris), clipboard.OpCopy},
+		{"x-special/gnome-copied-files", clipboard.OpCut, []byte("cut\n" + uris), clipboard.OpCut},
+		// GNOME and KDE know no links, the files are copied.
+		{"x-special/gnome-copied-files", clipboard.OpLink, []byte("copy\n" + uris), clipboard.OpCopy},
+		{"application/x-kde-cutselection", clipboard.OpCopy, nil, clipboard.OpCopy},
+		{"application/x-kde-cutselection", clipboard.OpCut, []byte("1"), clipboard.OpCut},
+		{"application/x-kde-cutselection", clipboard.OpLink, nil, clipboard.OpCopy},
+	} {
+		fake := clipboardtest.New()
+		board := clipboard.New(fake)
+		if _, err := board.WriteFilesWithOperation(files, c.op); err != nil {
+			t.Fatal(err)
+		}
+		// Keep the files and the encoding under test only, as a file
+		// manager of that system would.
+		var items []clipboardtest.Item
+		for _, item := range fake.Items() {
+			if item.Type == clipboardtest.TypeFiles || item.Type == c.encoding {
+				items = append(items, item)
+			}
+		}
+		fake.Set(items...)
+		data, err := fake.ReadFormat(c.encoding)
+		switch {
+		case c.data == nil && err == nil:
+			t.Errorf("%v %v: written as %q, want nothing", c.encoding, c.op, data)
+		case c.data != nil && !bytes.Equal(data, c.data):
+			t.Errorf("%v %v: written as %q, %v, want %q", c.encoding, c.op, data, err, c.data)
+		}
+		got, op, err := board.ReadFilesWithOperation()
+		if err != nil || !slices.Equal(got, files) || op != c.read {
+			t.Errorf("%v %v: read %q, %v, %v, want %v", c.encoding, c.op, got, op, err, c.read)
+		}
+	}
+}
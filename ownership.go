@@ -0,0 +1,72 @@
+package clipboard
+
+import (
+	"context"
+	"sync"
+)
+
+// Ownership is the content put on the clipboard by a write, it tells
+// when that content is replaced.
+type Ownership struct {
+	// Seq is the change count the write led to, see ChangeCount.
+	Seq uint64
+
+	backend Backend
+	// lost is closed by backends which are told when the content is
+	// replaced, the change count is watched for the others.
+	lost <-chan struct{}
+	once sync.Once
+	done chan struct{}
+}
+
+// lost_backend is implemented by backends which are told when content
+// they wrote is replaced: on X11 by SelectionClear, on Wayland by the
+// cancellation of the data source. lost returns nil when they are not.
+type lost_backend interface {
+	lost(seq uint64) <-chan struct{}
+}
+
+var closed_chan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+func new_ownership(b Backend, seq uint64) *Ownership {
+	o := &Ownership{Seq: seq, backend: b, done: make(chan struct{})}
+	if l, ok := b.(lost_backend); ok {
+		o.lost = l.lost(seq)
+	}
+	return o
+}
+
+// Done returns a channel which is closed once the content is replaced,
+// by another write of this process or by another application.
+func (o *Ownership) Done() <-chan struct{} {
+	o.once.Do(func() {
+		go o.watch()
+	})
+	return o.done
+}
+
+// Overwritten reports whether the content was replaced.
+func (o *Ownership) Overwritten() bool {
+	if o.lost != nil {
+		select {
+		case <-o.lost:
+			return true
+		default:
+			return false
+		}
+	}
+	return o.backend.ChangeCount() != o.Seq
+}
+
+func (o *Ownership) watch() {
+	defer close(o.done)
+	if o.lost != nil {
+		<-o.lost
+		return
+	}
+	wait_for_change(context.Background(), o.backend, o.Seq)
+}
@@ -0,0 +1,48 @@
+package clipboard_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ltaoo/clipboard-go"
+	"github.com/ltaoo/clipboard-go/clipboardtest"
+)
+
+func TestOwnership(t *testing.T) {
+	replace := map[string]func(fake *clipboardtest.Backend){
+		"foreign write": func(fake *clipboardtest.Backend) {
+			fake.Set(clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte("foreign")})
+		},
+		"write of another Clipboard": func(fake *clipboardtest.Backend) {
+			clipboard.New(fake).WriteText("other")
+		},
+	}
+	for name, replace := range replace {
+		fake := clipboardtest.New()
+		c := clipboard.New(fake)
+		o, err := c.WriteTextOwned("own")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o.Seq != c.ChangeCount() {
+			t.Errorf("%v: Seq = %d, want %d", name, o.Seq, c.ChangeCount())
+		}
+		if o.Overwritten() {
+			t.Errorf("%v: overwritten right after the write", name)
+		}
+		select {
+		case <-o.Done():
+			t.Fatalf("%v: done right after the write", name)
+		case <-time.After(20 * time.Millisecond):
+		}
+		replace(fake)
+		select {
+		case <-o.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%v: not done", name)
+		}
+		if !o.Overwritten() {
+			t.Errorf("%v: not overwritten", name)
+		}
+	}
+}
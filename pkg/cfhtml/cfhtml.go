@@ -0,0 +1,147 @@
+// Package cfhtml encodes and decodes the "HTML Format" of the Windows
+// clipboard, also known as CF_HTML. It is HTML preceded by a header
+// whose byte offsets locate the document and the copied fragment in it:
+//
+//	Version:0.9
+//	StartHTML:0000000105
+//	EndHTML:0000000185
+//	StartFragment:0000000139
+//	EndFragment:0000000151
+//	<html><body>
+//	<!--StartFragment--><b>Hello</b><!--EndFragment-->
+//	</body></html>
+//
+// https://learn.microsoft.com/en-us/windows/win32/dataxchg/html-clipboard-format
+package cfhtml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalid is returned by Decode for data without a valid header.
+var ErrInvalid = errors.New("cfhtml: invalid CF_HTML data")
+
+// Markers of the fragment in the document.
+const (
+	StartFragment = "<!--StartFragment-->"
+	EndFragment   = "<!--EndFragment-->"
+)
+
+// Document is the content of CF_HTML data.
+type Document struct {
+	// HTML is the whole document.
+	HTML string
+	// Fragment is the part of the document that was copied.
+	Fragment string
+	// SourceURL is the address of the page the fragment was copied
+	// from, empty if unknown.
+	SourceURL string
+}
+
+const (
+	prefix = "<html><body>\r\n" + StartFragment
+	suffix = EndFragment + "\r\n</body></html>"
+)
+
+// Encode returns fragment as CF_HTML, wrapped in a minimal document.
+// source_url may be empty. NUL characters are left out, they end the
+// data for the applications reading it.
+func Encode(fragment string, source_url string) []byte {
+	fragment = strings.ReplaceAll(fragment, "\x00", "")
+	// A line break would end the header early.
+	source_url = strings.NewReplacer("\r", "", "\n", "", "\x00", "").Replace(source_url)
+	// Offsets are written with a fixed width, so the length of the
+	// header is known before they are.
+	header := func(start_html, end_html, start_fragment, end_fragment int) string {
+		h := fmt.Sprintf("Version:0.9\r\nStartHTML:%010d\r\nEndHTML:%010d\r\nStartFragment:%010d\r\nEndFragment:%010d\r\n",
+			start_html, end_html, start_fragment, end_fragment)
+		if source_url != "" {
+			h += "SourceURL:" + source_url + "\r\n"
+		}
+		return h
+	}
+	start_html := len(header(0, 0, 0, 0))
+	start_fragment := start_html + len(prefix)
+	end_fragment := start_fragment + len(fragment)
+	end_html := end_fragment + len(suffix)
+	var buf bytes.Buffer
+	buf.Grow(end_html)
+	buf.WriteString(header(start_html, end_html, start_fragment, end_fragment))
+	buf.WriteString(prefix)
+	buf.WriteString(fragment)
+	buf.WriteString(suffix)
+	return buf.Bytes()
+}
+
+// Decode parses CF_HTML data. Offsets out of range, which some
+// applications write, are replaced by the position of the fragment
+// markers.
+func Decode(data []byte) (Document, error) {
+	// Global memory handed out by the clipboard is often NUL padded.
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	var doc Document
+	offsets := map[string]int{}
+	rest := data
+	header_end := 0
+	for len(rest) > 0 {
+		line := rest
+		n := len(rest)
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line, n = rest[:i], i+1
+		}
+		key, value, ok := strings.Cut(strings.TrimRight(string(line), "\r"), ":")
+		if !ok || key == "" || strings.ContainsAny(key, "<> \t") {
+			break
+		}
+		switch key {
+		case "StartHTML", "EndHTML", "StartFragment", "EndFragment", "StartSelection", "EndSelection":
+			v, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return doc, fmt.Errorf("%w: %v", ErrInvalid, err)
+			}
+			offsets[key] = v
+		case "SourceURL":
+			doc.SourceURL = strings.TrimSpace(value)
+		}
+		rest = rest[n:]
+		header_end += n
+	}
+	if _, ok := offsets["StartFragment"]; !ok {
+		if _, ok := offsets["StartHTML"]; !ok {
+			return doc, ErrInvalid
+		}
+	}
+	valid := func(start, end int) bool {
+		return start >= header_end && start <= end && end <= len(data)
+	}
+
+	start, end := offsets["StartHTML"], offsets["EndHTML"]
+	if !valid(start, end) {
+		// StartHTML is -1 when there is no context.
+		start, end = header_end, len(data)
+	}
+	doc.HTML = string(data[start:end])
+
+	start, end = offsets["StartFragment"], offsets["EndFragment"]
+	if !valid(start, end) {
+		start = bytes.Index(data, []byte(StartFragment))
+		end = bytes.LastIndex(data, []byte(EndFragment))
+		if start < 0 || end < start {
+			doc.Fragment = doc.HTML
+			return doc, nil
+		}
+		start += len(StartFragment)
+	}
+	fragment := string(data[start:end])
+	// Some applications include the markers in the fragment.
+	fragment = strings.TrimPrefix(fragment, StartFragment)
+	fragment = strings.TrimSuffix(fragment, EndFragment)
+	doc.Fragment = fragment
+	return doc, nil
+}
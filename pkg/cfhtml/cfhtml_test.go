@@ -0,0 +1,97 @@
+package cfhtml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	got := string(Encode("<b>Hello</b>", ""))
+	want := "Version:0.9\r\n" +
+		"StartHTML:0000000105\r\n" +
+		"EndHTML:0000000185\r\n" +
+		"StartFragment:0000000139\r\n" +
+		"EndFragment:0000000151\r\n" +
+		"<html><body>\r\n<!--StartFragment--><b>Hello</b><!--EndFragment-->\r\n</body></html>"
+	if got != want {
+		t.Errorf("Encode = %q, want %q", got, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct{ fragment, source_url string }{
+		{"<b>Hello</b>", ""},
+		{"", ""},
+		{"<p>你好, été \U0001F600</p>", "https://example.com/a?b=c"},
+		{"line\r\nbreaks\n", "https://example.com/"},
+	} {
+		doc, err := Decode(Encode(tc.fragment, tc.source_url))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Fragment != tc.fragment || doc.SourceURL != tc.source_url {
+			t.Errorf("round trip of %q, %q = %q, %q", tc.fragment, tc.source_url, doc.Fragment, doc.SourceURL)
+		}
+		if !strings.Contains(doc.HTML, tc.fragment) {
+			t.Errorf("HTML %q lacks the fragment", doc.HTML)
+		}
+	}
+}
+
+func TestEncodeStripsControlCharacters(t *testing.T) {
+	doc, err := Decode(Encode("0", "\x00"))
+	if err != nil || doc.Fragment != "0" || doc.SourceURL != "" {
+		t.Errorf("NUL source URL: %+v, %v", doc, err)
+	}
+	doc, err = Decode(Encode("a\x00b", "http://x/\r\ny"))
+	if err != nil || doc.Fragment != "ab" || doc.SourceURL != "http://x/y" {
+		t.Errorf("%+v, %v", doc, err)
+	}
+}
+
+func TestDecodeBadOffsets(t *testing.T) {
+	data := "Version:0.9\r\nStartHTML:-1\r\nEndHTML:-1\r\nStartFragment:0000009999\r\nEndFragment:0000009999\r\n" +
+		"<html><body><!--StartFragment-->hi<!--EndFragment--></body></html>\x00\x00"
+	doc, err := Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Fragment != "hi" || !strings.HasPrefix(doc.HTML, "<html>") {
+		t.Errorf("Decode = %+v", doc)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, data := range []string{"", "<b>no header</b>", "Version:0.9\r\nStartFragment:abc\r\n"} {
+		if _, err := Decode([]byte(data)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Decode(%q) = %v", data, err)
+		}
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("<b>Hello</b>", "")
+	f.Add("你好", "https://example.com/")
+	f.Fuzz(func(t *testing.T, fragment, source_url string) {
+		doc, err := Decode(Encode(fragment, source_url))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := strings.ReplaceAll(fragment, "\x00", "")
+		// Markers at the ends of the fragment are taken for ones
+		// applications include.
+		want = strings.TrimPrefix(want, StartFragment)
+		want = strings.TrimSuffix(want, EndFragment)
+		if doc.Fragment != want {
+			t.Fatalf("fragment %q decoded as %q", fragment, doc.Fragment)
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(Encode("<b>Hello</b>", "https://example.com/"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Decode(data)
+	})
+}
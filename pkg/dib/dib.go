@@ -0,0 +1,462 @@
+// Package dib encodes and decodes device independent bitmaps (DIB), the
+// image format of the Windows clipboard (CF_DIB and CF_DIBV5). A DIB is
+// a BMP file without its 14 byte file header: a BITMAPINFOHEADER,
+// BITMAPV4HEADER or BITMAPV5HEADER, the color masks and color table if
+// any, then the pixels.
+//
+// Decode reads 1, 4 and 8 bit palette images, 16, 24 and 32 bit images
+// with default or BI_BITFIELDS masks, and embedded PNG and JPEG images,
+// stored from the bottom up or the top down. Encode writes 32 bit images
+// keeping the alpha channel, or 24 bit opaque ones.
+//
+// https://learn.microsoft.com/en-us/windows/win32/gdi/device-independent-bitmaps
+package dib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/bits"
+)
+
+var (
+	// ErrInvalid is returned for truncated or inconsistent data.
+	ErrInvalid = errors.New("dib: invalid bitmap")
+	// ErrUnsupported is returned for valid bitmaps this package cannot
+	// decode, such as run-length encoded ones.
+	ErrUnsupported = errors.New("dib: unsupported bitmap")
+)
+
+// Sizes of the headers, which identify them.
+const (
+	CoreHeaderSize = 12
+	InfoHeaderSize = 40
+	V4HeaderSize   = 108
+	V5HeaderSize   = 124
+)
+
+// Compression methods.
+const (
+	BI_RGB            = 0
+	BI_RLE8           = 1
+	BI_RLE4           = 2
+	BI_BITFIELDS      = 3
+	BI_JPEG           = 4
+	BI_PNG            = 5
+	BI_ALPHABITFIELDS = 6
+)
+
+const (
+	lcs_sRGB      = 0x73524742
+	lcs_gm_images = 4
+	// The resolution written by Encode, 96 DPI.
+	pels_per_meter = 3780
+)
+
+// FileHeaderSize is the size of the header BMP files start with.
+const FileHeaderSize = 14
+
+// Options tune Encode and Decode.
+type Options struct {
+	// Premultiplied tells that the color values are premultiplied by
+	// alpha. Decode then returns an *image.RGBA, an *image.NRGBA
+	// otherwise.
+	Premultiplied bool
+	// Header is the header size Encode writes, InfoHeaderSize or
+	// V5HeaderSize, which is the default. Only the latter describes
+	// the alpha channel.
+	Header int
+	// BitCount is the number of bits per pixel Encode writes, 24 or 32,
+	// which is the default.
+	BitCount int
+	// TopDown makes Encode store the first row first.
+	TopDown bool
+}
+
+// Header describes a bitmap, see DecodeHeader.
+type Header struct {
+	Size           int
+	Width          int
+	Height         int // positive even when stored top down
+	TopDown        bool
+	BitCount       int
+	Compression    uint32
+	SizeImage      int
+	ColorsUsed     int
+	RedMask        uint32
+	GreenMask      uint32
+	BlueMask       uint32
+	AlphaMask      uint32
+	ColorSpace     uint32 // V4 and V5 headers only
+	Intent         uint32 // V5 headers only
+	PixelsPerMeter image.Point
+}
+
+var le = binary.LittleEndian
+
+// DecodeHeader parses the header at the start of data.
+func DecodeHeader(data []byte) (Header, error) {
+	var h Header
+	if len(data) < 4 {
+		return h, ErrInvalid
+	}
+	h.Size = int(le.Uint32(data))
+	if h.Size < CoreHeaderSize || len(data) < h.Size {
+		return h, fmt.Errorf("%w: header of %d bytes", ErrInvalid, h.Size)
+	}
+	if h.Size == CoreHeaderSize {
+		// OS/2 BITMAPCOREHEADER.
+		h.Width = int(le.Uint16(data[4:]))
+		h.Height = int(le.Uint16(data[6:]))
+		h.BitCount = int(le.Uint16(data[10:]))
+		return h, h.check()
+	}
+	if h.Size < InfoHeaderSize {
+		return h, fmt.Errorf("%w: header of %d bytes", ErrInvalid, h.Size)
+	}
+	h.Width = int(int32(le.Uint32(data[4:])))
+	height := int32(le.Uint32(data[8:]))
+	h.BitCount = int(le.Uint16(data[14:]))
+	h.Compression = le.Uint32(data[16:])
+	h.SizeImage = int(le.Uint32(data[20:]))
+	h.PixelsPerMeter = image.Pt(int(int32(le.Uint32(data[24:]))), int(int32(le.Uint32(data[28:]))))
+	h.ColorsUsed = int(le.Uint32(data[32:]))
+	if height < 0 {
+		h.TopDown = true
+		height = -height
+	}
+	h.Height = int(height)
+	// BITMAPV2INFOHEADER and later hold the masks.
+	if h.Size >= 52 {
+		h.RedMask = le.Uint32(data[40:])
+		h.GreenMask = le.Uint32(data[44:])
+		h.BlueMask = le.Uint32(data[48:])
+	}
+	if h.Size >= 56 {
+		h.AlphaMask = le.Uint32(data[52:])
+	}
+	if h.Size >= V4HeaderSize {
+		h.ColorSpace = le.Uint32(data[56:])
+	}
+	if h.Size >= V5HeaderSize {
+		h.Intent = le.Uint32(data[108:])
+	}
+	return h, h.check()
+}
+
+func (h Header) check() error {
+	if h.Width <= 0 || h.Height <= 0 {
+		return fmt.Errorf("%w: size %dx%d", ErrInvalid, h.Width, h.Height)
+	}
+	switch h.BitCount {
+	case 0:
+		if h.Compression != BI_PNG && h.Compression != BI_JPEG {
+			return fmt.Errorf("%w: no bit count", ErrInvalid)
+		}
+	case 1, 4, 8, 16, 24, 32:
+	default:
+		return fmt.Errorf("%w: %d bits per pixel", ErrInvalid, h.BitCount)
+	}
+	return nil
+}
+
+// stride returns the size of a row of pixels, rows are padded to four
+// bytes.
+func (h Header) stride() int {
+	return (h.Width*h.BitCount + 31) / 32 * 4
+}
+
+// Decode decodes a DIB, without file header.
+func Decode(data []byte) (image.Image, error) {
+	return DecodeOptions(data, Options{})
+}
+
+// DecodeOptions decodes a DIB, without file header, as told by opts.
+func DecodeOptions(data []byte, opts Options) (image.Image, error) {
+	return decode(data, -1, opts)
+}
+
+// DecodeBMP decodes a BMP file, which is a DIB after a file header.
+func DecodeBMP(data []byte) (image.Image, error) {
+	if len(data) < FileHeaderSize || data[0] != 'B' || data[1] != 'M' {
+		return nil, fmt.Errorf("%w: not a BMP file", ErrInvalid)
+	}
+	offset := int(le.Uint32(data[10:])) - FileHeaderSize
+	return decode(data[FileHeaderSize:], offset, Options{})
+}
+
+// decode decodes the DIB in data, whose pixels start at offset or, if
+// it is negative, right after the header, masks and color table.
+func decode(data []byte, offset int, opts Options) (image.Image, error) {
+	h, err := DecodeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	pos := h.Size
+	// A BITMAPINFOHEADER is followed by the masks, which later headers
+	// contain.
+	switch {
+	case h.Size == InfoHeaderSize && h.Compression == BI_BITFIELDS:
+		if len(data) < pos+12 {
+			return nil, ErrInvalid
+		}
+		h.RedMask, h.GreenMask, h.BlueMask = le.Uint32(data[pos:]), le.Uint32(data[pos+4:]), le.Uint32(data[pos+8:])
+		pos += 12
+	case h.Size == InfoHeaderSize && h.Compression == BI_ALPHABITFIELDS:
+		if len(data) < pos+16 {
+			return nil, ErrInvalid
+		}
+		h.RedMask, h.GreenMask, h.BlueMask = le.Uint32(data[pos:]), le.Uint32(data[pos+4:]), le.Uint32(data[pos+8:])
+		h.AlphaMask = le.Uint32(data[pos+12:])
+		pos += 16
+	}
+	var palette color.Palette
+	if h.BitCount > 0 && h.BitCount <= 8 {
+		n := h.ColorsUsed
+		if n == 0 || n > 1<<h.BitCount {
+			n = 1 << h.BitCount
+		}
+		entry := 4
+		if h.Size == CoreHeaderSize {
+			entry = 3
+		}
+		if len(data) < pos+n*entry {
+			return nil, fmt.Errorf("%w: truncated color table", ErrInvalid)
+		}
+		palette = make(color.Palette, n)
+		for i := range palette {
+			c := data[pos+i*entry:]
+			palette[i] = color.NRGBA{R: c[2], G: c[1], B: c[0], A: 0xff}
+		}
+		pos += n * entry
+	} else if h.ColorsUsed > 0 && h.ColorsUsed <= 1<<16 {
+		// An optional palette to display true color images with.
+		pos += h.ColorsUsed * 4
+	}
+	if offset < 0 {
+		offset = pos
+	}
+	if offset > len(data) {
+		return nil, fmt.Errorf("%w: no pixels", ErrInvalid)
+	}
+	pixels := data[offset:]
+
+	switch h.Compression {
+	case BI_PNG:
+		return png.Decode(bytes.NewReader(pixels))
+	case BI_JPEG:
+		return jpeg.Decode(bytes.NewReader(pixels))
+	case BI_RGB, BI_BITFIELDS, BI_ALPHABITFIELDS:
+	default:
+		return nil, fmt.Errorf("%w: compression %d", ErrUnsupported, h.Compression)
+	}
+
+	stride := h.stride()
+	size := stride * h.Height
+	if stride <= 0 || size/stride != h.Height || len(pixels) < size {
+		return nil, fmt.Errorf("%w: truncated pixels", ErrInvalid)
+	}
+	// Some applications write masks after a V5 header as well.
+	if offset == pos && h.Size > InfoHeaderSize && h.Compression == BI_BITFIELDS && len(pixels) == size+12 {
+		pixels = pixels[12:]
+	}
+	row := func(y int) []byte {
+		if !h.TopDown {
+			y = h.Height - 1 - y
+		}
+		return pixels[y*stride : (y+1)*stride]
+	}
+
+	if palette != nil {
+		img := image.NewPaletted(image.Rect(0, 0, h.Width, h.Height), palette)
+		mask := byte(1<<h.BitCount - 1)
+		for y := 0; y < h.Height; y++ {
+			r := row(y)
+			for x := 0; x < h.Width; x++ {
+				bit := x * h.BitCount
+				i := r[bit/8] >> (8 - h.BitCount - bit%8) & mask
+				if int(i) >= len(palette) {
+					i = 0
+				}
+				img.Pix[y*img.Stride+x] = i
+			}
+		}
+		return img, nil
+	}
+
+	if h.Compression == BI_RGB {
+		// The masks of the header do not apply.
+		switch h.BitCount {
+		case 16:
+			h.RedMask, h.GreenMask, h.BlueMask, h.AlphaMask = 0x7c00, 0x03e0, 0x001f, 0
+		case 24, 32:
+			h.RedMask, h.GreenMask, h.BlueMask = 0xff0000, 0xff00, 0xff
+			// The fourth byte is reserved, yet it holds alpha in the
+			// bitmaps of many applications.
+			h.AlphaMask = 0
+			if h.BitCount == 32 {
+				h.AlphaMask = 0xff000000
+			}
+		}
+	}
+	channels := [4]channel{new_channel(h.RedMask), new_channel(h.GreenMask), new_channel(h.BlueMask), new_channel(h.AlphaMask)}
+	bpp := h.BitCount / 8
+	pix := make([]byte, 4*h.Width*h.Height)
+	has_alpha := false
+	for y := 0; y < h.Height; y++ {
+		r := row(y)
+		out := pix[4*h.Width*y:]
+		for x := 0; x < h.Width; x++ {
+			var v uint32
+			switch bpp {
+			case 2:
+				v = uint32(le.Uint16(r[2*x:]))
+			case 3:
+				v = uint32(r[3*x]) | uint32(r[3*x+1])<<8 | uint32(r[3*x+2])<<16
+			case 4:
+				v = le.Uint32(r[4*x:])
+			}
+			o := out[4*x : 4*x+4]
+			for i, c := range channels {
+				o[i] = c.get(v)
+			}
+			if channels[3].mask == 0 {
+				o[3] = 0xff
+			} else if o[3] != 0 {
+				has_alpha = true
+			}
+		}
+	}
+	if channels[3].mask != 0 && !has_alpha {
+		// An alpha channel of zeros means the image has none.
+		for i := 3; i < len(pix); i += 4 {
+			pix[i] = 0xff
+		}
+	}
+	rect := image.Rect(0, 0, h.Width, h.Height)
+	if opts.Premultiplied {
+		for i := 0; i < len(pix); i += 4 {
+			// Invalid values would overflow when compositing.
+			for j := 0; j < 3; j++ {
+				pix[i+j] = min(pix[i+j], pix[i+3])
+			}
+		}
+		return &image.RGBA{Pix: pix, Stride: 4 * h.Width, Rect: rect}, nil
+	}
+	return &image.NRGBA{Pix: pix, Stride: 4 * h.Width, Rect: rect}, nil
+}
+
+// channel extracts a color channel from a pixel with its mask.
+type channel struct {
+	mask  uint32
+	shift int
+	max   uint32
+}
+
+func new_channel(mask uint32) channel {
+	if mask == 0 {
+		return channel{}
+	}
+	shift := bits.TrailingZeros32(mask)
+	width := bits.OnesCount32(mask >> shift)
+	return channel{mask: mask, shift: shift, max: 1<<width - 1}
+}
+
+func (c channel) get(v uint32) byte {
+	if c.mask == 0 {
+		return 0
+	}
+	v = (v & c.mask) >> c.shift
+	if c.max == 0xff {
+		return byte(v)
+	}
+	// Masks need not be contiguous, clamp what lies above max.
+	return byte(min(v, c.max) * 0xff / c.max)
+}
+
+// Encode encodes img as a 32 bit DIB with a BITMAPV5HEADER, which keeps
+// its alpha channel.
+func Encode(img image.Image) []byte {
+	return EncodeOptions(img, Options{})
+}
+
+// EncodeOptions encodes img as told by opts.
+func EncodeOptions(img image.Image, opts Options) []byte {
+	header := opts.Header
+	if header != InfoHeaderSize {
+		header = V5HeaderSize
+	}
+	bit_count := opts.BitCount
+	if bit_count != 24 {
+		bit_count = 32
+	}
+	b := img.Bounds()
+	h := Header{Width: b.Dx(), Height: b.Dy(), BitCount: bit_count}
+	stride := h.stride()
+	buf := make([]byte, header+stride*h.Height)
+
+	le.PutUint32(buf[0:], uint32(header))
+	le.PutUint32(buf[4:], uint32(h.Width))
+	height := int32(h.Height)
+	if opts.TopDown {
+		height = -height
+	}
+	le.PutUint32(buf[8:], uint32(height))
+	le.PutUint16(buf[12:], 1)
+	le.PutUint16(buf[14:], uint16(bit_count))
+	le.PutUint32(buf[20:], uint32(stride*h.Height))
+	le.PutUint32(buf[24:], pels_per_meter)
+	le.PutUint32(buf[28:], pels_per_meter)
+	if header == V5HeaderSize {
+		if bit_count == 32 {
+			le.PutUint32(buf[16:], BI_BITFIELDS)
+			le.PutUint32(buf[40:], 0x00ff0000)
+			le.PutUint32(buf[44:], 0x0000ff00)
+			le.PutUint32(buf[48:], 0x000000ff)
+			le.PutUint32(buf[52:], 0xff000000)
+		}
+		le.PutUint32(buf[56:], lcs_sRGB)
+		le.PutUint32(buf[108:], lcs_gm_images)
+	}
+
+	pixels := buf[header:]
+	for y := 0; y < h.Height; y++ {
+		row := y
+		if !opts.TopDown {
+			row = h.Height - 1 - y
+		}
+		out := pixels[row*stride:]
+		for x := 0; x < h.Width; x++ {
+			c := img.At(b.Min.X+x, b.Min.Y+y)
+			var r, g, bl, a uint8
+			if opts.Premultiplied {
+				r16, g16, b16, a16 := c.RGBA()
+				r, g, bl, a = uint8(r16>>8), uint8(g16>>8), uint8(b16>>8), uint8(a16>>8)
+			} else {
+				n := color.NRGBAModel.Convert(c).(color.NRGBA)
+				r, g, bl, a = n.R, n.G, n.B, n.A
+			}
+			if bit_count == 24 {
+				out[3*x], out[3*x+1], out[3*x+2] = bl, g, r
+				continue
+			}
+			out[4*x], out[4*x+1], out[4*x+2], out[4*x+3] = bl, g, r, a
+		}
+	}
+	return buf
+}
+
+// EncodeBMP encodes img as a BMP file, see Encode.
+func EncodeBMP(img image.Image) []byte {
+	dib := Encode(img)
+	buf := make([]byte, FileHeaderSize, FileHeaderSize+len(dib))
+	buf[0], buf[1] = 'B', 'M'
+	le.PutUint32(buf[2:], uint32(FileHeaderSize+len(dib)))
+	le.PutUint32(buf[10:], FileHeaderSize+V5HeaderSize)
+	return append(buf, dib...)
+}
@@ -0,0 +1,151 @@
+package dib
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func read_png(t *testing.T, name string) image.Image {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "_example", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// same_pixels reports the first pixel of a and b which differs in its
+// non-premultiplied value.
+func same_pixels(t *testing.T, a, b image.Image) {
+	t.Helper()
+	if a.Bounds().Size() != b.Bounds().Size() {
+		t.Fatalf("size %v, want %v", b.Bounds().Size(), a.Bounds().Size())
+	}
+	ab, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			ca := color.NRGBAModel.Convert(a.At(ab.Min.X+x, ab.Min.Y+y)).(color.NRGBA)
+			cb := color.NRGBAModel.Convert(b.At(bb.Min.X+x, bb.Min.Y+y)).(color.NRGBA)
+			if ca.A == 0 && cb.A == 0 {
+				continue
+			}
+			if ca != cb {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, cb, ca)
+			}
+		}
+	}
+}
+
+func TestDecodeBMPSample(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "_example", "sample1.bmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := DecodeBMP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same_pixels(t, read_png(t, "sample1.png"), img)
+}
+
+// gradient returns an image with every alpha value, opaque if alpha is
+// false.
+func gradient(alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 37, 19))
+	for y := 0; y < 19; y++ {
+		for x := 0; x < 37; x++ {
+			a := uint8(255)
+			if alpha {
+				a = uint8(x * 7)
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 6), G: uint8(y * 13), B: uint8(x ^ y), A: a})
+		}
+	}
+	return img
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		opts  Options
+		alpha bool
+	}{
+		{"v5", Options{}, true},
+		{"v5 top down", Options{TopDown: true}, true},
+		{"v5 24 bit", Options{BitCount: 24}, false},
+		{"info 32 bit", Options{Header: InfoHeaderSize}, false},
+		{"info 24 bit", Options{Header: InfoHeaderSize, BitCount: 24}, false},
+		{"info 24 bit top down", Options{Header: InfoHeaderSize, BitCount: 24, TopDown: true}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := gradient(tc.alpha)
+			data := EncodeOptions(want, tc.opts)
+			h, err := DecodeHeader(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Width != 37 || h.Height != 19 || h.TopDown != tc.opts.TopDown {
+				t.Fatalf("header %+v", h)
+			}
+			got, err := Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			same_pixels(t, want, got)
+		})
+	}
+}
+
+func TestRoundTripPNG(t *testing.T) {
+	want := read_png(t, "sample2.png")
+	got, err := Decode(Encode(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	same_pixels(t, want, got)
+
+	got, err = DecodeBMP(EncodeBMP(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	same_pixels(t, want, got)
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	data := Encode(gradient(true))
+	for _, bad := range [][]byte{nil, data[:10], data[:V5HeaderSize], data[:len(data)-1]} {
+		if _, err := Decode(bad); err == nil {
+			t.Errorf("Decode of %d bytes succeeded", len(bad))
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(Encode(gradient(true)))
+	f.Add(EncodeOptions(gradient(false), Options{Header: InfoHeaderSize, BitCount: 24, TopDown: true}))
+	if data, err := os.ReadFile(filepath.Join("..", "..", "_example", "sample1.bmp")); err == nil && len(data) > FileHeaderSize {
+		f.Add(data[FileHeaderSize:])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, err := Decode(data)
+		if err != nil {
+			return
+		}
+		// Every pixel of a decoded image can be read.
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				img.At(x, y)
+			}
+		}
+	})
+}
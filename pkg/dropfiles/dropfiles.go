@@ -0,0 +1,127 @@
+// Package dropfiles encodes and decodes the DROPFILES structure, which
+// holds the files copied to the Windows clipboard (CF_HDROP) or dropped
+// on a window:
+//
+//	DWORD pFiles // offset of the file list
+//	POINT pt     // drop point
+//	BOOL  fNC    // whether pt is in the non-client area
+//	BOOL  fWide  // whether the file names are UTF-16
+//
+// The file list follows, every name terminated by a NUL character and
+// the list by another one.
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/shlobj_core/ns-shlobj_core-dropfiles
+package dropfiles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"unicode/utf16"
+)
+
+// ErrInvalid is returned by Decode for truncated or inconsistent data.
+var ErrInvalid = errors.New("dropfiles: invalid DROPFILES data")
+
+// HeaderSize is the size of the DROPFILES structure.
+const HeaderSize = 20
+
+// DropFiles is a list of files with the point they were dropped at.
+type DropFiles struct {
+	Files []string
+	// Point is the drop point in client coordinates of the window, or
+	// in the non-client area if NonClient is set. It is zero for files
+	// on the clipboard.
+	Point     image.Point
+	NonClient bool
+	// ANSI tells that the names are in the ANSI code page of the
+	// system instead of UTF-16. They are exchanged as is, so only
+	// ASCII names are portable.
+	ANSI bool
+}
+
+var le = binary.LittleEndian
+
+// Encode returns d as DROPFILES structure followed by the file list.
+// Empty names, which would end the list, are left out.
+func Encode(d DropFiles) []byte {
+	buf := make([]byte, HeaderSize)
+	le.PutUint32(buf[0:], HeaderSize)
+	le.PutUint32(buf[4:], uint32(int32(d.Point.X)))
+	le.PutUint32(buf[8:], uint32(int32(d.Point.Y)))
+	if d.NonClient {
+		le.PutUint32(buf[12:], 1)
+	}
+	if d.ANSI {
+		for _, f := range d.Files {
+			if f == "" {
+				continue
+			}
+			buf = append(buf, f...)
+			buf = append(buf, 0)
+		}
+		return append(buf, 0)
+	}
+	le.PutUint32(buf[16:], 1)
+	for _, f := range d.Files {
+		if f == "" {
+			continue
+		}
+		for _, c := range utf16.Encode([]rune(f)) {
+			buf = le.AppendUint16(buf, c)
+		}
+		buf = le.AppendUint16(buf, 0)
+	}
+	return le.AppendUint16(buf, 0)
+}
+
+// Decode parses a DROPFILES structure and the file list following it.
+// A list missing its final terminator, as some applications write it,
+// is accepted.
+func Decode(data []byte) (DropFiles, error) {
+	var d DropFiles
+	if len(data) < HeaderSize {
+		return d, fmt.Errorf("%w: %d bytes", ErrInvalid, len(data))
+	}
+	offset := le.Uint32(data[0:])
+	if offset < HeaderSize || uint64(offset) > uint64(len(data)) {
+		return d, fmt.Errorf("%w: file list at %d", ErrInvalid, offset)
+	}
+	d.Point = image.Pt(int(int32(le.Uint32(data[4:]))), int(int32(le.Uint32(data[8:]))))
+	d.NonClient = le.Uint32(data[12:]) != 0
+	d.ANSI = le.Uint32(data[16:]) == 0
+	list := data[offset:]
+	if d.ANSI {
+		for len(list) > 0 {
+			end := bytes.IndexByte(list, 0)
+			if end < 0 {
+				end = len(list)
+			}
+			if end == 0 {
+				break
+			}
+			d.Files = append(d.Files, string(list[:end]))
+			list = list[min(end+1, len(list)):]
+		}
+		return d, nil
+	}
+	var name []uint16
+	for i := 0; i+1 < len(list); i += 2 {
+		c := le.Uint16(list[i:])
+		if c != 0 {
+			name = append(name, c)
+			continue
+		}
+		if len(name) == 0 {
+			break
+		}
+		d.Files = append(d.Files, string(utf16.Decode(name)))
+		name = name[:0]
+	}
+	if len(name) > 0 {
+		d.Files = append(d.Files, string(utf16.Decode(name)))
+	}
+	return d, nil
+}
@@ -0,0 +1,104 @@
+package dropfiles
+
+import (
+	"errors"
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, d := range []DropFiles{
+		{Files: []string{`C:\Users\me\My Notes.txt`, "\\\\server\\share\\r\u00e9sum\u00e9.pdf", "D:\\\U0001F600"}},
+		{Files: []string{`C:\a.txt`, `D:\b`}, ANSI: true},
+		{Files: []string{`C:\a.txt`}, Point: image.Pt(-3, 7), NonClient: true},
+	} {
+		got, err := Decode(Encode(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, d) {
+			t.Errorf("Decode(Encode(%+v)) = %+v", d, got)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	data := Encode(DropFiles{Files: []string{"a", "", "b"}, Point: image.Pt(1, 2), NonClient: true})
+	want := []byte{
+		20, 0, 0, 0, // pFiles
+		1, 0, 0, 0, 2, 0, 0, 0, // pt
+		1, 0, 0, 0, // fNC
+		1, 0, 0, 0, // fWide
+		'a', 0, 0, 0, 'b', 0, 0, 0, 0, 0,
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("Encode = %v, want %v", data, want)
+	}
+	data = Encode(DropFiles{Files: []string{"a", "b"}, ANSI: true})
+	if got := data[HeaderSize:]; string(got) != "a\x00b\x00\x00" || data[16] != 0 {
+		t.Errorf("ANSI Encode = %q", data)
+	}
+}
+
+func TestDecodeMissingTerminator(t *testing.T) {
+	for _, d := range []DropFiles{
+		{Files: []string{"a", "bc"}},
+		{Files: []string{"a", "bc"}, ANSI: true},
+	} {
+		data := Encode(d)
+		// Without the final NUL, then without the one ending the last
+		// name.
+		for _, cut := range []int{1, 2} {
+			n := cut
+			if !d.ANSI {
+				n *= 2
+			}
+			got, err := Decode(data[:len(data)-n])
+			if err != nil || !reflect.DeepEqual(got.Files, d.Files) {
+				t.Errorf("Decode without %d NULs = %q, %v", cut, got.Files, err)
+			}
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	data := Encode(DropFiles{Files: []string{"a"}})
+	if _, err := Decode(data[:HeaderSize-1]); !errors.Is(err, ErrInvalid) {
+		t.Errorf("short header: %v", err)
+	}
+	for _, offset := range []byte{0, HeaderSize - 1, byte(len(data) + 1), 0xff} {
+		bad := append([]byte(nil), data...)
+		bad[0] = offset
+		if _, err := Decode(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("offset %d: %v", offset, err)
+		}
+	}
+	// An offset right at the end is an empty list.
+	bad := append([]byte(nil), data...)
+	bad[0] = byte(len(data))
+	if d, err := Decode(bad); err != nil || len(d.Files) != 0 {
+		t.Errorf("offset at the end = %q, %v", d.Files, err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(Encode(DropFiles{Files: []string{`C:\a`, "\\\\h\\s\\\u00e9"}}))
+	f.Add(Encode(DropFiles{Files: []string{`C:\a`}, ANSI: true, Point: image.Pt(5, 5)}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d, err := Decode(data)
+		if err != nil {
+			return
+		}
+		// Names decoded from valid data survive a round trip, wide
+		// names unless they hold unpaired surrogates, which decode to
+		// U+FFFD.
+		got, err := Decode(Encode(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Files) != len(d.Files) || got.Point != d.Point || got.NonClient != d.NonClient || got.ANSI != d.ANSI {
+			t.Fatalf("round trip of %+v = %+v", d, got)
+		}
+	})
+}
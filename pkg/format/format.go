@@ -0,0 +1,171 @@
+// Package format is a registry of clipboard formats. Every format has a
+// canonical name, a MIME type, and the identifiers the platforms use for
+// it: UTIs on macOS, clipboard format names on Windows and targets on
+// X11, which double as MIME types on Wayland.
+//
+// The clipboard package reports and accepts the canonical names on every
+// system, applications can add their own formats with Register:
+//
+//	format.Register(format.Format{
+//		Name:    "application/x-myapp-state",
+//		UTIs:    []string{"com.example.myapp.state"},
+//		Windows: []string{"MyApp State"},
+//		X11:     []string{"application/x-myapp-state"},
+//	})
+package format
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Canonical names of the predefined formats.
+const (
+	Text    = "text/plain;charset=utf-8"
+	HTML    = "text/html"
+	RTF     = "text/rtf"
+	PNG     = "image/png"
+	URIList = "text/uri-list"
+	// URL is a single URL, encoded as UTF-8. The native formats may
+	// append a title on the next line or a NUL terminator.
+	URL = "text/x-url"
+)
+
+// Format maps a canonical name to the native identifiers of each
+// platform, in order of preference. The clipboard backends convert the
+// data of the predefined formats between their identifiers, the data of
+// registered formats is exchanged unchanged under the first identifier
+// of the platform.
+type Format struct {
+	// Name is the canonical name, a MIME type.
+	Name string
+	// UTIs are macOS pasteboard types.
+	UTIs []string
+	// Windows are clipboard format names, either predefined such as
+	// "CF_UNICODETEXT" or registered such as "HTML Format".
+	Windows []string
+	// X11 are selection targets, Wayland uses them as MIME types.
+	X11 []string
+}
+
+var (
+	mu      sync.RWMutex
+	formats = []Format{
+		{
+			Name:    Text,
+			UTIs:    []string{"public.utf8-plain-text", "NSStringPboardType"},
+			Windows: []string{"CF_UNICODETEXT", "CF_TEXT", "CF_OEMTEXT"},
+			X11:     []string{"UTF8_STRING", "text/plain;charset=utf-8", "text/plain", "STRING", "TEXT"},
+		},
+		{
+			Name:    HTML,
+			UTIs:    []string{"public.html", "Apple HTML pasteboard type"},
+			Windows: []string{"HTML Format"},
+			X11:     []string{"text/html"},
+		},
+		{
+			Name:    RTF,
+			UTIs:    []string{"public.rtf", "NeXT Rich Text Format v1.0 pasteboard type"},
+			Windows: []string{"Rich Text Format"},
+			X11:     []string{"text/rtf", "application/rtf"},
+		},
+		{
+			Name:    PNG,
+			UTIs:    []string{"public.png", "Apple PNG pasteboard type"},
+			Windows: []string{"PNG", "CF_DIBV5", "CF_DIB", "CF_BITMAP"},
+			X11:     []string{"image/png", "image/bmp", "image/jpeg"},
+		},
+		{
+			Name:    URIList,
+			UTIs:    []string{"public.file-url", "NSFilenamesPboardType"},
+			Windows: []string{"CF_HDROP"},
+			X11:     []string{"text/uri-list"},
+		},
+		{
+			Name:    URL,
+			UTIs:    []string{"public.url"},
+			Windows: []string{"UniformResourceLocator"},
+			X11:     []string{"_NETSCAPE_URL"},
+		},
+	}
+)
+
+// Register adds f to the registry, replacing the format of the same
+// name. Identifiers already used by another format keep resolving to it.
+func Register(f Format) error {
+	if f.Name == "" {
+		return errors.New("format: empty name")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range formats {
+		if strings.EqualFold(formats[i].Name, f.Name) {
+			formats[i] = f
+			return nil
+		}
+	}
+	formats = append(formats, f)
+	return nil
+}
+
+// All returns every registered format.
+func All() []Format {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Format(nil), formats...)
+}
+
+// Lookup returns the format whose canonical name is name.
+func Lookup(name string) (Format, bool) {
+	return find(func(f Format) bool { return strings.EqualFold(f.Name, name) })
+}
+
+// FromUTI returns the format a macOS pasteboard type belongs to.
+func FromUTI(uti string) (Format, bool) {
+	return find(func(f Format) bool { return contains(f.UTIs, uti) })
+}
+
+// FromWindows returns the format a Windows clipboard format name belongs
+// to.
+func FromWindows(name string) (Format, bool) {
+	return find(func(f Format) bool { return contains(f.Windows, name) })
+}
+
+// FromX11 returns the format an X11 target or Wayland MIME type belongs
+// to.
+func FromX11(target string) (Format, bool) {
+	return find(func(f Format) bool { return contains(f.X11, target) })
+}
+
+// Canonical returns the canonical name of name, which may be a canonical
+// name or a native identifier of any platform. Unknown names are
+// returned unchanged.
+func Canonical(name string) string {
+	if f, ok := find(func(f Format) bool {
+		return strings.EqualFold(f.Name, name) || contains(f.UTIs, name) || contains(f.Windows, name) || contains(f.X11, name)
+	}); ok {
+		return f.Name
+	}
+	return name
+}
+
+func find(match func(f Format) bool) (Format, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, f := range formats {
+		if match(f) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
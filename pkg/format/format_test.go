@@ -0,0 +1,152 @@
+package format
+
+import (
+	"slices"
+	"testing"
+)
+
+// restore puts the registry back as it was once the test is done.
+func restore(t *testing.T) {
+	saved := All()
+	t.Cleanup(func() {
+		mu.Lock()
+		formats = saved
+		mu.Unlock()
+	})
+}
+
+func TestLookup(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		want string // "" when not found
+	}{
+		{Text, Text},
+		{"TEXT/PLAIN;CHARSET=UTF-8", Text},
+		{HTML, HTML},
+		{RTF, RTF},
+		{PNG, PNG},
+		{URIList, URIList},
+		{URL, URL},
+		{"UTF8_STRING", ""},
+		{"application/x-unknown", ""},
+		{"", ""},
+	} {
+		f, ok := Lookup(c.name)
+		if ok != (c.want != "") || f.Name != c.want {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", c.name, f.Name, ok, c.want)
+		}
+	}
+}
+
+func TestNative(t *testing.T) {
+	for _, c := range []struct {
+		lookup func(string) (Format, bool)
+		id     string
+		want   string // "" when not found
+	}{
+		{FromUTI, "public.utf8-plain-text", Text},
+		{FromUTI, "NSStringPboardType", Text},
+		{FromUTI, "Apple HTML pasteboard type", HTML},
+		{FromUTI, "public.rtf", RTF},
+		{FromUTI, "public.png", PNG},
+		{FromUTI, "public.file-url", URIList},
+		{FromUTI, "public.url", URL},
+		{FromUTI, "public.jpeg", ""},
+		{FromWindows, "CF_UNICODETEXT", Text},
+		{FromWindows, "CF_TEXT", Text},
+		{FromWindows, "HTML Format", HTML},
+		{FromWindows, "Rich Text Format", RTF},
+		{FromWindows, "CF_DIBV5", PNG},
+		{FromWindows, "CF_HDROP", URIList},
+		{FromWindows, "UniformResourceLocator", URL},
+		{FromWindows, "cf_unicodetext", ""},
+		{FromX11, "UTF8_STRING", Text},
+		{FromX11, "STRING", Text},
+		{FromX11, "text/html", HTML},
+		{FromX11, "application/rtf", RTF},
+		{FromX11, "image/bmp", PNG},
+		{FromX11, "text/uri-list", URIList},
+		{FromX11, "_NETSCAPE_URL", URL},
+		{FromX11, "TARGETS", ""},
+	} {
+		f, ok := c.lookup(c.id)
+		if ok != (c.want != "") || f.Name != c.want {
+			t.Errorf("lookup of %q = %q, %v, want %q", c.id, f.Name, ok, c.want)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	for _, c := range []struct{ name, want string }{
+		{Text, Text},
+		{"Text/Plain;Charset=UTF-8", Text},
+		{"text/plain", Text},
+		{"NSStringPboardType", Text},
+		{"CF_OEMTEXT", Text},
+		{"public.html", HTML},
+		{"NeXT Rich Text Format v1.0 pasteboard type", RTF},
+		{"PNG", PNG},
+		{"NSFilenamesPboardType", URIList},
+		{"_NETSCAPE_URL", URL},
+		{"application/x-unknown", "application/x-unknown"},
+		{"", ""},
+	} {
+		if got := Canonical(c.name); got != c.want {
+			t.Errorf("Canonical(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	restore(t)
+	if err := Register(Format{}); err == nil {
+		t.Error("Register of an empty name succeeded")
+	}
+	state := Format{
+		Name:    "application/x-myapp-state",
+		UTIs:    []string{"com.example.myapp.state"},
+		Windows: []string{"MyApp State"},
+		X11:     []string{"application/x-myapp-state"},
+	}
+	n := len(All())
+	if err := Register(state); err != nil {
+		t.Fatal(err)
+	}
+	if len(All()) != n+1 {
+		t.Errorf("%d formats after Register, want %d", len(All()), n+1)
+	}
+	for _, id := range []string{"APPLICATION/X-MYAPP-STATE", "com.example.myapp.state", "MyApp State"} {
+		if got := Canonical(id); got != state.Name {
+			t.Errorf("Canonical(%q) = %q, want %q", id, got, state.Name)
+		}
+	}
+	if f, ok := FromWindows("MyApp State"); !ok || f.Name != state.Name {
+		t.Errorf("FromWindows = %q, %v", f.Name, ok)
+	}
+
+	// Registering a name again replaces its format.
+	state.Windows = []string{"MyApp State v2"}
+	if err := Register(state); err != nil {
+		t.Fatal(err)
+	}
+	if len(All()) != n+1 {
+		t.Errorf("%d formats after registering again, want %d", len(All()), n+1)
+	}
+	if f, _ := Lookup(state.Name); !slices.Equal(f.Windows, state.Windows) {
+		t.Errorf("Windows = %q, want %q", f.Windows, state.Windows)
+	}
+	if _, ok := FromWindows("MyApp State"); ok {
+		t.Error("the replaced identifier still resolves")
+	}
+
+	// Identifiers of the predefined formats keep resolving to them.
+	if err := Register(Format{Name: "text/x-mine", X11: []string{"UTF8_STRING", "text/x-mine"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := Canonical("UTF8_STRING"); got != Text {
+		t.Errorf("Canonical(UTF8_STRING) = %q, want %q", got, Text)
+	}
+	if f, ok := FromX11("text/x-mine"); !ok || f.Name != "text/x-mine" {
+		t.Errorf("FromX11(text/x-mine) = %q, %v", f.Name, ok)
+	}
+}
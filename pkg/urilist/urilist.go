@@ -0,0 +1,269 @@
+// Package urilist converts file paths to and from file URIs (RFC 8089)
+// and encodes and decodes text/uri-list (RFC 2483), the format files are
+// exchanged in on Linux and, as public.file-url, on macOS:
+//
+//	# copied from /home/me
+//	file:///home/me/My%20Notes.txt
+//	file:///C:/Users/me/r%C3%A9sum%C3%A9.pdf
+//	file://server/share/report.doc
+//
+// Paths are converted the same way on every system. POSIX paths map to
+// URIs without a host, Windows paths with a drive letter to URIs whose
+// path starts with it, and UNC paths to URIs with the server as host.
+package urilist
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalid is returned for malformed URIs.
+	ErrInvalid = errors.New("urilist: invalid file URI")
+	// ErrNotFile is returned by ToPath for URIs of another scheme.
+	ErrNotFile = errors.New("urilist: not a file URI")
+	// ErrRelative is returned by FromPath for relative paths, which
+	// have no URI.
+	ErrRelative = errors.New("urilist: relative path")
+)
+
+// List is the content of text/uri-list.
+type List struct {
+	URIs []string
+	// Comments are the comment lines, without the leading "#".
+	Comments []string
+}
+
+// Decode parses text/uri-list. Lines may end with CRLF, as the format
+// requires, or with LF only; blank lines are skipped.
+func Decode(data []byte) List {
+	var l List
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if c, ok := strings.CutPrefix(line, "#"); ok {
+			l.Comments = append(l.Comments, strings.TrimPrefix(c, " "))
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			l.URIs = append(l.URIs, line)
+		}
+	}
+	return l
+}
+
+// Encode returns l as text/uri-list, the comments first, every line
+// ended by CRLF.
+func Encode(l List) []byte {
+	var b strings.Builder
+	for _, c := range l.Comments {
+		for _, line := range strings.Split(strings.ReplaceAll(c, "\r", ""), "\n") {
+			b.WriteString("# " + line + "\r\n")
+		}
+	}
+	for _, uri := range l.URIs {
+		b.WriteString(uri + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+// Paths returns the paths of the file URIs in text/uri-list data, other
+// URIs are skipped.
+func Paths(data []byte) []string {
+	var paths []string
+	for _, uri := range Decode(data).URIs {
+		if p, err := ToPath(uri); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// FromPaths returns paths as text/uri-list. Empty paths are skipped.
+func FromPaths(paths []string) ([]byte, error) {
+	var l List
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		uri, err := FromPath(p)
+		if err != nil {
+			return nil, err
+		}
+		l.URIs = append(l.URIs, uri)
+	}
+	return Encode(l), nil
+}
+
+// FromPath returns the file URI of an absolute path, which is either a
+// POSIX path, a Windows path with a drive letter, or a UNC path. A path
+// starting with "//" is only taken for a UNC path when it has
+// backslashes as well, //tmp/x is the POSIX path /tmp/x.
+// Characters that may not appear in the path of a URI are
+// percent-encoded as UTF-8.
+func FromPath(path string) (string, error) {
+	// Extended-length paths: \\?\C:\dir and \\?\UNC\server\share.
+	if rest, ok := strings.CutPrefix(path, `\\?\`); ok {
+		path = rest
+		if rest, ok := cut_prefix_fold(path, `UNC\`); ok {
+			path = `\\` + rest
+		}
+	}
+	switch {
+	case is_drive(path) && path[1] == ':' && (len(path) == 2 || path[2] == '\\' || path[2] == '/'):
+		p := strings.ReplaceAll(path[2:], `\`, "/")
+		if p == "" {
+			p = "/"
+		}
+		return "file:///" + path[:2] + escape(p, false), nil
+	case len(path) > 2 && (path[:2] == `\\` || path[:2] == "//" && strings.Contains(path, `\`)) && path[2] != '/' && path[2] != '\\':
+		host, p, _ := strings.Cut(strings.ReplaceAll(path[2:], `\`, "/"), "/")
+		if host == "" {
+			return "", fmt.Errorf("%w: %q", ErrInvalid, path)
+		}
+		return "file://" + escape(host, true) + "/" + escape(p, false), nil
+	case strings.HasPrefix(path, "/"):
+		// Leading slashes of a POSIX path name the root as a single one
+		// does, more would make the URI a UNC path.
+		p := strings.TrimLeft(path, "/")
+		if is_drive(p) && p[1] == ':' {
+			// A POSIX path like /C:/dir, the colon is escaped so that it
+			// is not taken for a drive.
+			return "file:///" + p[:1] + "%3A" + escape(p[2:], false), nil
+		}
+		return "file:///" + escape(p, false), nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrRelative, path)
+}
+
+// ToPath returns the path of a file URI, the inverse of FromPath. URIs
+// without a host, with "localhost" as host, in the short form file:/path
+// and in the legacy forms file:///C|/dir and file:////server/share are
+// accepted, as are unescaped spaces and non-ASCII characters.
+func ToPath(uri string) (string, error) {
+	scheme, rest, ok := strings.Cut(uri, ":")
+	if !ok || !strings.EqualFold(scheme, "file") {
+		return "", fmt.Errorf("%w: %q", ErrNotFile, uri)
+	}
+	// The fragment and the query are not part of the path.
+	if i := strings.IndexAny(rest, "#?"); i >= 0 {
+		rest = rest[:i]
+	}
+	host := ""
+	if after, ok := strings.CutPrefix(rest, "//"); ok {
+		host, rest, _ = strings.Cut(after, "/")
+		rest = "/" + rest
+		// file://C:/dir, written by some Windows applications.
+		if len(host) == 2 && is_drive(host) {
+			rest = "/" + host + rest
+			host = ""
+		}
+	}
+	// Drives are told from the escaped path, see FromPath.
+	drive := len(rest) >= 3 && rest[0] == '/' && is_drive(rest[1:]) && (len(rest) == 3 || rest[3] == '/')
+	if !drive && is_drive(rest) && (len(rest) == 2 || rest[2] == '/') {
+		// file:C:/dir
+		rest = "/" + rest
+		drive = true
+	}
+	path, err := unescape(rest)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrInvalid, uri, err)
+	}
+	if host, err = unescape(host); err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrInvalid, uri, err)
+	}
+	if strings.EqualFold(host, "localhost") {
+		host = ""
+	}
+	switch {
+	case host != "":
+		return `\\` + host + strings.ReplaceAll(path, "/", `\`), nil
+	case drive:
+		p := strings.ReplaceAll(path[3:], "/", `\`)
+		if p == "" {
+			p = `\`
+		}
+		return path[1:2] + ":" + p, nil
+	case strings.HasPrefix(path, "//") && len(path) > 2 && path[2] != '/':
+		return `\\` + strings.ReplaceAll(path[2:], "/", `\`), nil
+	case strings.HasPrefix(path, "/"):
+		return path, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalid, uri)
+}
+
+// is_drive tells whether s starts with a drive letter followed by a
+// colon, or by a vertical bar as in old URIs.
+func is_drive(s string) bool {
+	if len(s) < 2 {
+		return false
+	}
+	c := s[0] | 0x20
+	return c >= 'a' && c <= 'z' && (s[1] == ':' || s[1] == '|')
+}
+
+func cut_prefix_fold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
+
+const hex = "0123456789ABCDEF"
+
+// escape percent-encodes every byte of s but the unreserved characters,
+// the sub-delimiters and ":" and "@", which may appear in a path, and
+// "/" unless s is a host.
+func escape(s string, host bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("-._~!$&'()*+,;=:@", c) >= 0 || c == '/' && !host {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
+
+// unescape decodes the percent-encoded bytes of s, leaving the others
+// as they are.
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("truncated escape %q", s[i:])
+		}
+		hi, lo := unhex(s[i+1]), unhex(s[i+2])
+		if hi < 0 || lo < 0 {
+			return "", fmt.Errorf("bad escape %q", s[i:i+3])
+		}
+		b.WriteByte(byte(hi<<4 | lo))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+func unhex(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
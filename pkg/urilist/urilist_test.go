@@ -0,0 +1,124 @@
+package urilist
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFromPath(t *testing.T) {
+	for _, c := range []struct{ path, uri string }{
+		{"/home/me/My Notes.txt", "file:///home/me/My%20Notes.txt"},
+		{"/", "file:///"},
+		{"//tmp/x", "file:///tmp/x"},
+		{"///tmp/x", "file:///tmp/x"},
+		{"/C:/dir", "file:///C%3A/dir"},
+		{"//C:/dir", "file:///C%3A/dir"},
+		{"/r\u00e9sum\u00e9#1?.pdf", "file:///r%C3%A9sum%C3%A9%231%3F.pdf"},
+		{`C:\Users\me\a.txt`, "file:///C:/Users/me/a.txt"},
+		{`C:`, "file:///C:/"},
+		{`C:/dir`, "file:///C:/dir"},
+		{`\\server\share\report.doc`, "file://server/share/report.doc"},
+		{`//server/share\report.doc`, "file://server/share/report.doc"},
+		{`\\?\C:\dir`, "file:///C:/dir"},
+		{`\\?\UNC\server\share`, "file://server/share"},
+	} {
+		uri, err := FromPath(c.path)
+		if err != nil || uri != c.uri {
+			t.Errorf("FromPath(%q) = %q, %v, want %q", c.path, uri, err, c.uri)
+		}
+	}
+}
+
+func TestFromPathInvalid(t *testing.T) {
+	for _, c := range []struct {
+		path string
+		err  error
+	}{
+		{"", ErrRelative},
+		{"a/b", ErrRelative},
+		{`dir\a.txt`, ErrRelative},
+	} {
+		if uri, err := FromPath(c.path); !errors.Is(err, c.err) {
+			t.Errorf("FromPath(%q) = %q, %v, want %v", c.path, uri, err, c.err)
+		}
+	}
+}
+
+func TestToPath(t *testing.T) {
+	for _, c := range []struct{ uri, path string }{
+		{"file:///home/me/My%20Notes.txt", "/home/me/My Notes.txt"},
+		{"file://localhost/tmp/x", "/tmp/x"},
+		{"file:/tmp/x", "/tmp/x"},
+		{"file:///tmp/a b", "/tmp/a b"},
+		{"file:///tmp/x#frag", "/tmp/x"},
+		{"file:///C%3A/dir", "/C:/dir"},
+		{"file:///C:/Users/me/r%C3%A9sum%C3%A9.pdf", "C:\\Users\\me\\r\u00e9sum\u00e9.pdf"},
+		{"file:///C|/dir", `C:\dir`},
+		{"file://C:/dir", `C:\dir`},
+		{"file:C:/dir", `C:\dir`},
+		{"file://server/share/report.doc", `\\server\share\report.doc`},
+		{"file:////server/share", `\\server\share`},
+	} {
+		path, err := ToPath(c.uri)
+		if err != nil || path != c.path {
+			t.Errorf("ToPath(%q) = %q, %v, want %q", c.uri, path, err, c.path)
+		}
+	}
+}
+
+func TestToPathInvalid(t *testing.T) {
+	for _, c := range []struct {
+		uri string
+		err error
+	}{
+		{"https://example.com/a", ErrNotFile},
+		{"/tmp/x", ErrNotFile},
+		{"file:///tmp/%zz", ErrInvalid},
+		{"file:///tmp/%2", ErrInvalid},
+		{"file:relative", ErrInvalid},
+	} {
+		if path, err := ToPath(c.uri); !errors.Is(err, c.err) {
+			t.Errorf("ToPath(%q) = %q, %v, want %v", c.uri, path, err, c.err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, path := range []string{
+		"/home/me/My Notes.txt",
+		"/tmp/100%.txt",
+		"/C:/dir",
+		"/\U0001F600",
+		`C:\Users\me\a b.txt`,
+		`\\server\share\r` + "\u00e9sum\u00e9.pdf",
+	} {
+		uri, err := FromPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ToPath(uri)
+		if err != nil || got != path {
+			t.Errorf("ToPath(FromPath(%q)) = %q, %v", path, got, err)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	data := []byte("# copied\r\nfile:///a\r\n\r\nhttps://example.com/\nfile:///b%20c\n")
+	l := Decode(data)
+	want := List{URIs: []string{"file:///a", "https://example.com/", "file:///b%20c"}, Comments: []string{"copied"}}
+	if !reflect.DeepEqual(l, want) {
+		t.Errorf("Decode = %+v, want %+v", l, want)
+	}
+	if got := Paths(data); !reflect.DeepEqual(got, []string{"/a", "/b c"}) {
+		t.Errorf("Paths = %q", got)
+	}
+	if got := string(Encode(want)); got != "# copied\r\nfile:///a\r\nhttps://example.com/\r\nfile:///b%20c\r\n" {
+		t.Errorf("Encode = %q", got)
+	}
+	got, err := FromPaths([]string{"/a", "", "//b"})
+	if err != nil || string(got) != "file:///a\r\nfile:///b\r\n" {
+		t.Errorf("FromPaths = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,310 @@
+//go:build unix
+
+// Package wayland is a minimal client for the Wayland wire protocol.
+// It only knows the interfaces needed to access the clipboard through
+// the wlr and ext data-control protocols, which let clients without a
+// surface read and set the selection.
+//
+// Wire format reference:
+// https://wayland.freedesktop.org/docs/html/ch04.html#sect-Protocol-Wire-Format
+package wayland
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+var order = binary.LittleEndian
+
+// ErrClosed is returned by requests issued after the connection to the
+// compositor has been lost or closed.
+var ErrClosed = errors.New("wayland: connection closed")
+
+// Fd is a file descriptor argument, it is transferred out of band.
+type Fd int
+
+// Handler receives the events sent to one object. It runs on the
+// connection's read goroutine and must not block.
+type Handler func(opcode uint16, m *Message)
+
+// Conn is a connection to a Wayland compositor. All methods are safe for
+// concurrent use.
+type Conn struct {
+	conn *net.UnixConn
+
+	wmu     sync.Mutex // guards next_id and writes to conn
+	next_id uint32
+
+	hmu      sync.Mutex // guards handlers and err
+	handlers map[uint32]Handler
+	err      error
+	closed   chan struct{}
+
+	fds []int // received but not yet consumed descriptors, only used by read_loop
+}
+
+// Dial connects to the compositor socket called name, which has the
+// same meaning as $WAYLAND_DISPLAY. An empty name uses $WAYLAND_DISPLAY.
+func Dial(name string) (*Conn, error) {
+	if name == "" {
+		name = os.Getenv("WAYLAND_DISPLAY")
+	}
+	if name == "" {
+		return nil, errors.New("wayland: $WAYLAND_DISPLAY is not set")
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		dir := os.Getenv("XDG_RUNTIME_DIR")
+		if dir == "" {
+			return nil, errors.New("wayland: $XDG_RUNTIME_DIR is not set")
+		}
+		path = filepath.Join(dir, name)
+	}
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		conn:     conn,
+		next_id:  1, // wl_display
+		handlers: map[uint32]Handler{},
+		closed:   make(chan struct{}),
+	}
+	c.handlers[1] = c.handle_display
+	go c.read_loop()
+	return c, nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	err := c.conn.Close()
+	c.fail(ErrClosed)
+	return err
+}
+
+// Closed is closed once the connection to the compositor is gone.
+func (c *Conn) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// Err returns the reason the connection was closed, if it was.
+func (c *Conn) Err() error {
+	c.hmu.Lock()
+	defer c.hmu.Unlock()
+	return c.err
+}
+
+func (c *Conn) fail(err error) {
+	c.hmu.Lock()
+	defer c.hmu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.closed)
+}
+
+// NewID allocates a client side object id.
+func (c *Conn) NewID() uint32 {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.next_id++
+	return c.next_id
+}
+
+// Handle registers the event handler of object id.
+func (c *Conn) Handle(id uint32, h Handler) {
+	c.hmu.Lock()
+	defer c.hmu.Unlock()
+	c.handlers[id] = h
+}
+
+// Forget drops the handler of an object. Objects destroyed by the
+// client are forgotten once the compositor acknowledges it.
+func (c *Conn) Forget(id uint32) {
+	c.hmu.Lock()
+	defer c.hmu.Unlock()
+	delete(c.handlers, id)
+}
+
+// Send issues request opcode on object id. Arguments may be uint32,
+// int32, string or Fd; new_id and object arguments are plain uint32.
+func (c *Conn) Send(id uint32, opcode uint16, args ...interface{}) error {
+	buf := make([]byte, 8, 64)
+	var fds []int
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			buf = order.AppendUint32(buf, v)
+		case int32:
+			buf = order.AppendUint32(buf, uint32(v))
+		case string:
+			buf = order.AppendUint32(buf, uint32(len(v)+1))
+			buf = append(buf, v...)
+			buf = append(buf, 0)
+			for len(buf)%4 != 0 {
+				buf = append(buf, 0)
+			}
+		case Fd:
+			fds = append(fds, int(v))
+		default:
+			panic(fmt.Sprintf("wayland: unsupported argument type %T", arg))
+		}
+	}
+	order.PutUint32(buf[0:], id)
+	order.PutUint32(buf[4:], uint32(len(buf))<<16|uint32(opcode))
+	var oob []byte
+	if len(fds) > 0 {
+		oob = syscall.UnixRights(fds...)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.Err(); err != nil {
+		return err
+	}
+	if _, _, err := c.conn.WriteMsgUnix(buf, oob, nil); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) read_loop() {
+	buf := make([]byte, 0, 4096)
+	chunk := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(28*4))
+	for {
+		n, oobn, _, _, err := c.conn.ReadMsgUnix(chunk, oob)
+		if err != nil {
+			c.fail(ErrClosed)
+			c.close_fds()
+			return
+		}
+		if oobn > 0 {
+			msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+			if err == nil {
+				for _, msg := range msgs {
+					fds, err := syscall.ParseUnixRights(&msg)
+					if err == nil {
+						c.fds = append(c.fds, fds...)
+					}
+				}
+			}
+		}
+		buf = append(buf, chunk[:n]...)
+		for len(buf) >= 8 {
+			size := int(order.Uint32(buf[4:]) >> 16)
+			if size < 8 {
+				c.fail(errors.New("wayland: malformed message"))
+				c.conn.Close()
+				return
+			}
+			if len(buf) < size {
+				break
+			}
+			id := order.Uint32(buf[0:])
+			opcode := uint16(order.Uint32(buf[4:]))
+			m := &Message{conn: c, data: buf[8:size]}
+			c.hmu.Lock()
+			h := c.handlers[id]
+			c.hmu.Unlock()
+			if h != nil {
+				h(opcode, m)
+			}
+			buf = buf[size:]
+		}
+		// Compact so the buffer does not grow without bound.
+		buf = append(chunk[:0:0], buf...)
+	}
+}
+
+func (c *Conn) close_fds() {
+	for _, fd := range c.fds {
+		syscall.Close(fd)
+	}
+	c.fds = nil
+}
+
+func (c *Conn) handle_display(opcode uint16, m *Message) {
+	switch opcode {
+	case 0: // error
+		object := m.Uint()
+		code := m.Uint()
+		message := m.Text()
+		c.fail(fmt.Errorf("wayland: protocol error %d on object %d: %s", code, object, message))
+		c.conn.Close()
+	case 1: // delete_id
+		c.Forget(m.Uint())
+	}
+}
+
+// Roundtrip blocks until the compositor has processed every request sent
+// so far, and every event they caused has been dispatched.
+func (c *Conn) Roundtrip() error {
+	id := c.NewID()
+	done := make(chan struct{})
+	c.Handle(id, func(opcode uint16, m *Message) {
+		c.Forget(id)
+		close(done)
+	})
+	if err := c.Send(1, 0, id); err != nil { // wl_display.sync
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-c.closed:
+		return c.Err()
+	}
+}
+
+// Message is an event being dispatched. Its arguments are decoded in
+// order with the typed accessors.
+type Message struct {
+	conn *Conn
+	data []byte
+}
+
+// Uint decodes an uint, object or new_id argument.
+func (m *Message) Uint() uint32 {
+	if len(m.data) < 4 {
+		return 0
+	}
+	v := order.Uint32(m.data)
+	m.data = m.data[4:]
+	return v
+}
+
+// Int decodes an int argument.
+func (m *Message) Int() int32 {
+	return int32(m.Uint())
+}
+
+// Text decodes a string argument.
+func (m *Message) Text() string {
+	n := int(m.Uint())
+	size := (n + 3) &^ 3
+	if n == 0 || size > len(m.data) {
+		return ""
+	}
+	s := string(m.data[:n-1])
+	m.data = m.data[size:]
+	return s
+}
+
+// Fd takes the next received file descriptor. The caller owns it.
+func (m *Message) Fd() (*os.File, error) {
+	c := m.conn
+	if len(c.fds) == 0 {
+		return nil, errors.New("wayland: missing file descriptor")
+	}
+	fd := c.fds[0]
+	c.fds = c.fds[1:]
+	return os.NewFile(uintptr(fd), "wayland"), nil
+}
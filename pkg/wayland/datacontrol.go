@@ -0,0 +1,302 @@
+//go:build unix
+
+package wayland
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// Global is an object advertised by the compositor through wl_registry.
+type Global struct {
+	Name      uint32
+	Interface string
+	Version   uint32
+}
+
+// Globals returns the globals advertised by the compositor.
+func (c *Conn) Globals() ([]Global, uint32, error) {
+	registry := c.NewID()
+	var mu sync.Mutex
+	var globals []Global
+	c.Handle(registry, func(opcode uint16, m *Message) {
+		if opcode != 0 { // global_remove
+			return
+		}
+		g := Global{Name: m.Uint(), Interface: m.Text(), Version: m.Uint()}
+		mu.Lock()
+		globals = append(globals, g)
+		mu.Unlock()
+	})
+	if err := c.Send(1, 1, registry); err != nil { // wl_display.get_registry
+		return nil, 0, err
+	}
+	if err := c.Roundtrip(); err != nil {
+		return nil, 0, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return globals, registry, nil
+}
+
+// Bind creates a client object for global g.
+func (c *Conn) Bind(registry uint32, g Global, version uint32) (uint32, error) {
+	if version > g.Version {
+		version = g.Version
+	}
+	id := c.NewID()
+	return id, c.Send(registry, 0, g.Name, g.Interface, version, id)
+}
+
+// Data-control protocols, in order of preference. Both share the same
+// requests, events and opcodes.
+//
+// https://wayland.app/protocols/ext-data-control-v1
+// https://wayland.app/protocols/wlr-data-control-unstable-v1
+var data_control_managers = []struct {
+	iface   string
+	version uint32
+	primary uint32 // first version with primary selection support
+}{
+	{"ext_data_control_manager_v1", 1, 1},
+	{"zwlr_data_control_manager_v1", 2, 2},
+}
+
+// ErrNoDataControl is returned when the compositor offers none of the
+// data-control protocols (GNOME's mutter for example).
+var ErrNoDataControl = errors.New("wayland: compositor does not support a data-control protocol")
+
+// DataControl is a bound data-control manager together with the data
+// device of the first seat.
+type DataControl struct {
+	conn    *Conn
+	manager uint32
+	seat    uint32
+	device  uint32
+	// Interface is the name of the manager in use.
+	Interface string
+	// Primary reports whether the primary selection is supported.
+	Primary bool
+
+	mu     sync.Mutex
+	offers map[uint32]*DataOffer
+
+	// OnSelection is called with the new selection offer, or nil when the
+	// selection was cleared. OnPrimarySelection does the same for the
+	// primary selection. Both run on the read goroutine and must not
+	// block; they must be set before calling Start.
+	OnSelection        func(offer *DataOffer)
+	OnPrimarySelection func(offer *DataOffer)
+	// OnFinished is called when the device became invalid, it is
+	// destroyed right after.
+	OnFinished func()
+}
+
+// NewDataControl binds the preferred data-control manager and a seat.
+// Call Start once the callbacks are set to create the data device.
+func NewDataControl(c *Conn) (*DataControl, error) {
+	globals, registry, err := c.Globals()
+	if err != nil {
+		return nil, err
+	}
+	var seat *Global
+	for i := range globals {
+		if globals[i].Interface == "wl_seat" {
+			seat = &globals[i]
+			break
+		}
+	}
+	if seat == nil {
+		return nil, errors.New("wayland: compositor has no seat")
+	}
+	for _, want := range data_control_managers {
+		for _, g := range globals {
+			if g.Interface != want.iface {
+				continue
+			}
+			seat_id, err := c.Bind(registry, *seat, 1)
+			if err != nil {
+				return nil, err
+			}
+			manager, err := c.Bind(registry, g, want.version)
+			if err != nil {
+				return nil, err
+			}
+			d := &DataControl{
+				conn:      c,
+				manager:   manager,
+				Interface: want.iface,
+				Primary:   g.Version >= want.primary,
+				seat:      seat_id,
+				offers:    map[uint32]*DataOffer{},
+			}
+			return d, nil
+		}
+	}
+	return nil, ErrNoDataControl
+}
+
+// Start creates the data device. The compositor answers with the current
+// selection right away.
+func (d *DataControl) Start() error {
+	d.device = d.conn.NewID()
+	d.conn.Handle(d.device, d.handle_device)
+	return d.conn.Send(d.manager, 1, d.device, d.seat) // get_data_device
+}
+
+func (d *DataControl) handle_device(opcode uint16, m *Message) {
+	switch opcode {
+	case 0: // data_offer
+		offer := &DataOffer{conn: d.conn, ID: m.Uint()}
+		d.mu.Lock()
+		d.offers[offer.ID] = offer
+		d.mu.Unlock()
+		d.conn.Handle(offer.ID, offer.handle)
+	case 1, 3: // selection, primary_selection
+		id := m.Uint()
+		d.mu.Lock()
+		offer := d.offers[id]
+		d.mu.Unlock()
+		handler := d.OnSelection
+		if opcode == 3 {
+			handler = d.OnPrimarySelection
+		}
+		switch {
+		case handler != nil:
+			handler(offer)
+		case offer != nil:
+			// Nobody takes the offer, release it right away.
+			offer.Destroy(d)
+		}
+	case 2: // finished
+		if d.OnFinished != nil {
+			d.OnFinished()
+		}
+		d.conn.Send(d.device, 1) // destroy
+		d.conn.Forget(d.device)
+	}
+}
+
+// SetSelection makes source the selection, a nil source clears it.
+func (d *DataControl) SetSelection(source *DataSource) error {
+	var id uint32
+	if source != nil {
+		id = source.ID
+	}
+	return d.conn.Send(d.device, 0, id)
+}
+
+// SetPrimarySelection makes source the primary selection.
+func (d *DataControl) SetPrimarySelection(source *DataSource) error {
+	if !d.Primary {
+		return errors.New("wayland: primary selection is not supported")
+	}
+	var id uint32
+	if source != nil {
+		id = source.ID
+	}
+	return d.conn.Send(d.device, 2, id)
+}
+
+// DataOffer is the clipboard content offered by another client.
+type DataOffer struct {
+	conn *Conn
+	ID   uint32
+
+	mu    sync.Mutex
+	types []string
+}
+
+func (o *DataOffer) handle(opcode uint16, m *Message) {
+	if opcode == 0 { // offer
+		t := m.Text()
+		o.mu.Lock()
+		o.types = append(o.types, t)
+		o.mu.Unlock()
+	}
+}
+
+// Types returns the MIME types the offer can be converted to.
+func (o *DataOffer) Types() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.types...)
+}
+
+// Receive asks the source client to write the offer as mime_type into a
+// pipe and returns its read end. The data is complete at EOF.
+func (o *DataOffer) Receive(mime_type string) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	err = o.conn.Send(o.ID, 0, mime_type, Fd(w.Fd()))
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Destroy releases the offer. It must be called once the offer is no
+// longer the selection.
+func (o *DataOffer) Destroy(d *DataControl) {
+	d.mu.Lock()
+	delete(d.offers, o.ID)
+	d.mu.Unlock()
+	d.conn.Send(o.ID, 1)
+	// The compositor created the offer, it sends no delete_id for it.
+	d.conn.Forget(o.ID)
+}
+
+// DataSource is clipboard content published by this client.
+type DataSource struct {
+	conn *Conn
+	ID   uint32
+}
+
+// CreateDataSource creates a source offering mime_types. send is called
+// with a pipe to write mime_type into, it must close the file when done.
+// cancelled is called once the source was replaced, the source should
+// then be destroyed. Both run on the read goroutine.
+func (d *DataControl) CreateDataSource(mime_types []string, send func(mime_type string, f *os.File), cancelled func()) (*DataSource, error) {
+	s := &DataSource{conn: d.conn, ID: d.conn.NewID()}
+	d.conn.Handle(s.ID, func(opcode uint16, m *Message) {
+		switch opcode {
+		case 0: // send
+			mime_type := m.Text()
+			f, err := m.Fd()
+			if err != nil {
+				return
+			}
+			send(mime_type, f)
+		case 1: // cancelled
+			cancelled()
+		}
+	})
+	if err := d.conn.Send(d.manager, 0, s.ID); err != nil { // create_data_source
+		return nil, err
+	}
+	for _, t := range mime_types {
+		if err := d.conn.Send(s.ID, 0, t); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Destroy releases the source. Send events still in flight are answered
+// by closing their pipe.
+func (s *DataSource) Destroy() {
+	s.conn.Handle(s.ID, func(opcode uint16, m *Message) {
+		if opcode == 0 {
+			m.Text()
+			if f, err := m.Fd(); err == nil {
+				f.Close()
+			}
+		}
+	})
+	s.conn.Send(s.ID, 1)
+}
@@ -0,0 +1,587 @@
+//go:build linux
+
+package wayland
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// listen returns a listening compositor socket and its path.
+func listen(t *testing.T) (*net.UnixListener, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wayland-test")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, path
+}
+
+// pair returns a client connection and the compositor's end of it.
+func pair(t *testing.T) (*Conn, *net.UnixConn) {
+	t.Helper()
+	l, path := listen(t)
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	server, err := l.AcceptUnix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return c, server
+}
+
+// message encodes a message like Conn.Send, fds aside.
+func message(id uint32, opcode uint16, args ...interface{}) []byte {
+	buf := make([]byte, 8)
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			buf = order.AppendUint32(buf, v)
+		case string:
+			buf = order.AppendUint32(buf, uint32(len(v)+1))
+			buf = append(buf, v...)
+			buf = append(buf, make([]byte, 4-len(v)%4)...)
+		}
+	}
+	order.PutUint32(buf, id)
+	order.PutUint32(buf[4:], uint32(len(buf))<<16|uint32(opcode))
+	return buf
+}
+
+func TestDialName(t *testing.T) {
+	_, path := listen(t)
+	t.Setenv("XDG_RUNTIME_DIR", filepath.Dir(path))
+	t.Setenv("WAYLAND_DISPLAY", filepath.Base(path))
+	c, err := Dial("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	t.Setenv("WAYLAND_DISPLAY", "")
+	if _, err := Dial(""); err == nil {
+		t.Error("Dial without $WAYLAND_DISPLAY succeeded")
+	}
+}
+
+func TestSend(t *testing.T) {
+	c, server := pair(t)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := c.Send(5, 2, uint32(7), int32(-1), "abc", Fd(w.Fd())); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	buf := make([]byte, 64)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := server.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		5, 0, 0, 0, // object
+		2, 0, 24, 0, // opcode, size
+		7, 0, 0, 0,
+		0xff, 0xff, 0xff, 0xff,
+		4, 0, 0, 0, 'a', 'b', 'c', 0,
+	}
+	if !bytes.Equal(buf[:n], want) {
+		t.Errorf("message = %v, want %v", buf[:n], want)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("control messages = %v, %v", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("fds = %v, %v", fds, err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "sent")
+	f.Write([]byte("through"))
+	f.Close()
+	if data, _ := io.ReadAll(r); string(data) != "through" {
+		t.Errorf("pipe = %q", data)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	c, server := pair(t)
+	type event struct {
+		opcode uint16
+		n      uint32
+		i      int32
+		s      string
+		data   string
+	}
+	events := make(chan event, 4)
+	c.Handle(9, func(opcode uint16, m *Message) {
+		e := event{opcode: opcode, n: m.Uint(), i: m.Int(), s: m.Text()}
+		if opcode == 1 {
+			f, err := m.Fd()
+			if err == nil {
+				data, _ := io.ReadAll(f)
+				f.Close()
+				e.data = string(data)
+			}
+		}
+		events <- e
+	})
+	// Two messages in one write, then one split across two writes.
+	first := message(9, 0, uint32(1), uint32(0xfffffffe), "text/plain;charset=utf-8")
+	second := message(8, 0, uint32(2)) // no handler
+	third := message(9, 0, uint32(3), uint32(4), "")
+	server.Write(append(first, second...))
+	server.Write(third[:10])
+	time.Sleep(10 * time.Millisecond)
+	server.Write(third[10:])
+	// A descriptor along with its message.
+	r, w, _ := os.Pipe()
+	w.Write([]byte("fd data"))
+	w.Close()
+	server.WriteMsgUnix(message(9, 1, uint32(5), uint32(6), "x"), syscall.UnixRights(int(r.Fd())), nil)
+	r.Close()
+
+	want := []event{
+		{0, 1, -2, "text/plain;charset=utf-8", ""},
+		{0, 3, 4, "", ""},
+		{1, 5, 6, "x", "fd data"},
+	}
+	for _, w := range want {
+		select {
+		case e := <-events:
+			if e != w {
+				t.Errorf("event = %+v, want %+v", e, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event, want %+v", w)
+		}
+	}
+}
+
+func TestRoundtripAndDeleteID(t *testing.T) {
+	c, server := pair(t)
+	c.Handle(42, func(uint16, *Message) {})
+	go func() {
+		buf := make([]byte, 64)
+		n, err := server.Read(buf)
+		if err != nil || n != 12 || order.Uint32(buf) != 1 || order.Uint32(buf[4:]) != 12<<16 {
+			server.Close()
+			return
+		}
+		callback := order.Uint32(buf[8:])
+		server.Write(append(message(1, 1, uint32(42)), message(callback, 0, uint32(0))...))
+	}()
+	if err := c.Roundtrip(); err != nil {
+		t.Fatal(err)
+	}
+	c.hmu.Lock()
+	_, ok := c.handlers[42]
+	c.hmu.Unlock()
+	if ok {
+		t.Error("delete_id did not forget the object")
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	c, server := pair(t)
+	server.Write(message(1, 0, uint32(3), uint32(1), "invalid arguments"))
+	select {
+	case <-c.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed")
+	}
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "invalid arguments") {
+		t.Errorf("Err = %v", err)
+	}
+	if err := c.Send(1, 0, uint32(2)); err == nil {
+		t.Error("Send after the error succeeded")
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	c, server := pair(t)
+	server.Write([]byte{1, 0, 0, 0, 0, 0, 4, 0})
+	select {
+	case <-c.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed")
+	}
+	if c.Err() == nil || errors.Is(c.Err(), ErrClosed) {
+		t.Errorf("Err = %v", c.Err())
+	}
+}
+
+// compositor is a fake compositor offering a seat and the given
+// data-control managers to a single client. It hands the selection set
+// by the client back to it as an offer, and forwards receive requests
+// to the source.
+type compositor struct {
+	conn     *net.UnixConn
+	managers []Global
+
+	mu      sync.Mutex
+	objects map[uint32]string
+	types   map[uint32][]string // source -> MIME types
+	devices []uint32
+	offers  map[uint32]uint32 // offer -> source
+	current map[uint16]uint32 // selection event -> source
+	next    uint32
+	fds     []int
+}
+
+func serve_compositor(t *testing.T, managers ...Global) *Conn {
+	t.Helper()
+	c, _ := start_compositor(t, managers...)
+	return c
+}
+
+func start_compositor(t *testing.T, managers ...Global) (*Conn, *compositor) {
+	t.Helper()
+	c, server := pair(t)
+	s := &compositor{
+		conn:     server,
+		managers: managers,
+		objects:  map[uint32]string{1: "wl_display"},
+		types:    map[uint32][]string{},
+		offers:   map[uint32]uint32{},
+		current:  map[uint16]uint32{},
+		next:     0xff000000,
+	}
+	go s.run()
+	return c, s
+}
+
+// finish invalidates the data devices.
+func (s *compositor) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, device := range s.devices {
+		s.send(device, 2, -1)
+	}
+}
+
+// live returns the number of offers the client has not destroyed.
+func (s *compositor) live() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.offers)
+}
+
+func (s *compositor) send(id uint32, opcode uint16, fd int, args ...interface{}) {
+	var oob []byte
+	if fd >= 0 {
+		oob = syscall.UnixRights(fd)
+	}
+	s.conn.WriteMsgUnix(message(id, opcode, args...), oob, nil)
+}
+
+func (s *compositor) announce(event uint16, source uint32) {
+	for _, device := range s.devices {
+		if source == 0 {
+			s.send(device, event, -1, uint32(0))
+			continue
+		}
+		s.next++
+		s.offers[s.next] = source
+		s.send(device, 0, -1, s.next)
+		for _, t := range s.types[source] {
+			s.send(s.next, 0, -1, t)
+		}
+		s.send(device, event, -1, s.next)
+	}
+}
+
+func (s *compositor) run() {
+	var buf []byte
+	chunk := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(4*4))
+	for {
+		n, oobn, _, _, err := s.conn.ReadMsgUnix(chunk, oob)
+		if err != nil {
+			return
+		}
+		if msgs, err := syscall.ParseSocketControlMessage(oob[:oobn]); err == nil {
+			for _, m := range msgs {
+				fds, _ := syscall.ParseUnixRights(&m)
+				s.fds = append(s.fds, fds...)
+			}
+		}
+		buf = append(buf, chunk[:n]...)
+		for len(buf) >= 8 && len(buf) >= int(order.Uint32(buf[4:])>>16) {
+			size := int(order.Uint32(buf[4:]) >> 16)
+			m := &Message{data: buf[8:size]}
+			s.mu.Lock()
+			s.handle(order.Uint32(buf), uint16(order.Uint32(buf[4:])), m)
+			s.mu.Unlock()
+			buf = buf[size:]
+		}
+	}
+}
+
+func (s *compositor) handle(id uint32, opcode uint16, m *Message) {
+	switch iface := s.objects[id]; {
+	case iface == "wl_display" && opcode == 0: // sync
+		callback := m.Uint()
+		s.send(callback, 0, -1, uint32(0))
+		s.send(1, 1, -1, callback)
+	case iface == "wl_display" && opcode == 1: // get_registry
+		registry := m.Uint()
+		s.objects[registry] = "wl_registry"
+		s.send(registry, 0, -1, uint32(1), "wl_seat", uint32(7))
+		for i, g := range s.managers {
+			s.send(registry, 0, -1, uint32(2+i), g.Interface, g.Version)
+		}
+	case iface == "wl_registry": // bind
+		name := m.Uint()
+		iface := m.Text()
+		m.Uint()
+		if name == 1 {
+			iface = "wl_seat"
+		}
+		s.objects[m.Uint()] = iface
+	case strings.HasSuffix(iface, "data_control_manager_v1") && opcode == 0: // create_data_source
+		source := m.Uint()
+		s.objects[source] = "source"
+		s.types[source] = nil
+	case strings.HasSuffix(iface, "data_control_manager_v1") && opcode == 1: // get_data_device
+		device := m.Uint()
+		s.objects[device] = "device"
+		s.devices = append(s.devices, device)
+		s.announce(1, s.current[1])
+	case iface == "source" && opcode == 0: // offer
+		s.types[id] = append(s.types[id], m.Text())
+	case iface == "device" && (opcode == 0 || opcode == 2): // set_selection, set_primary_selection
+		event := uint16(1)
+		if opcode == 2 {
+			event = 3
+		}
+		source := m.Uint()
+		if old := s.current[event]; old != 0 && old != source {
+			s.send(old, 1, -1) // cancelled
+		}
+		s.current[event] = source
+		s.announce(event, source)
+	case id >= 0xff000000 && opcode == 0: // offer.receive
+		mime_type := m.Text()
+		fd := s.fds[0]
+		s.fds = s.fds[1:]
+		s.send(s.offers[id], 0, fd, mime_type)
+		syscall.Close(fd)
+	case iface == "device" && opcode == 1: // destroy
+		s.devices = slices.DeleteFunc(s.devices, func(d uint32) bool { return d == id })
+	case id >= 0xff000000 && opcode == 1: // offer.destroy
+		delete(s.offers, id)
+	}
+}
+
+func TestNewDataControl(t *testing.T) {
+	ext := Global{Interface: "ext_data_control_manager_v1", Version: 1}
+	wlr1 := Global{Interface: "zwlr_data_control_manager_v1", Version: 1}
+	wlr2 := Global{Interface: "zwlr_data_control_manager_v1", Version: 2}
+	for _, c := range []struct {
+		managers []Global
+		iface    string
+		primary  bool
+	}{
+		{[]Global{wlr2, ext}, ext.Interface, true},
+		{[]Global{wlr2}, wlr2.Interface, true},
+		{[]Global{wlr1}, wlr1.Interface, false},
+	} {
+		d, err := NewDataControl(serve_compositor(t, c.managers...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Interface != c.iface || d.Primary != c.primary {
+			t.Errorf("NewDataControl(%v) = %v, primary %v", c.managers, d.Interface, d.Primary)
+		}
+	}
+	if _, err := NewDataControl(serve_compositor(t)); !errors.Is(err, ErrNoDataControl) {
+		t.Errorf("NewDataControl without managers = %v", err)
+	}
+}
+
+func TestSelectionTransfer(t *testing.T) {
+	c := serve_compositor(t, Global{Interface: "zwlr_data_control_manager_v1", Version: 2})
+	d, err := NewDataControl(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offers := make(chan *DataOffer, 4)
+	d.OnSelection = func(offer *DataOffer) { offers <- offer }
+	primary := make(chan *DataOffer, 4)
+	d.OnPrimarySelection = func(offer *DataOffer) { primary <- offer }
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	next := func(ch chan *DataOffer) *DataOffer {
+		t.Helper()
+		select {
+		case o := <-ch:
+			return o
+		case <-time.After(time.Second):
+			t.Fatal("no selection event")
+		}
+		return nil
+	}
+	if o := next(offers); o != nil {
+		t.Fatalf("initial selection = %+v, want none", o)
+	}
+
+	cancelled := make(chan struct{}, 1)
+	types := []string{"text/plain;charset=utf-8", "UTF8_STRING"}
+	source, err := d.CreateDataSource(types, func(mime_type string, f *os.File) {
+		f.Write([]byte("hello as " + mime_type))
+		f.Close()
+	}, func() { cancelled <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetSelection(source); err != nil {
+		t.Fatal(err)
+	}
+	o := next(offers)
+	if o == nil || !slices.Equal(o.Types(), types) {
+		t.Fatalf("offer = %+v", o)
+	}
+	r, err := o.Receive("UTF8_STRING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "hello as UTF8_STRING" {
+		t.Errorf("received %q", data)
+	}
+	o.Destroy(d)
+
+	if err := d.SetPrimarySelection(source); err != nil {
+		t.Fatal(err)
+	}
+	if o := next(primary); o == nil || !slices.Equal(o.Types(), types) {
+		t.Errorf("primary offer = %+v", o)
+	}
+
+	// Replacing the selection cancels the source.
+	if err := d.SetSelection(nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("source not cancelled")
+	}
+	if o := next(offers); o != nil {
+		t.Errorf("cleared selection = %+v", o)
+	}
+	source.Destroy()
+}
+
+func TestOfferLifetime(t *testing.T) {
+	c, s := start_compositor(t, Global{Interface: "zwlr_data_control_manager_v1", Version: 2})
+	d, err := NewDataControl(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Like the clipboard backend: only the regular selection is handled,
+	// the previous offer is destroyed once replaced.
+	var current *DataOffer
+	d.OnSelection = func(offer *DataOffer) {
+		if current != nil {
+			current.Destroy(d)
+		}
+		current = offer
+	}
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	source, err := d.CreateDataSource([]string{"text/plain"}, func(mime_type string, f *os.File) { f.Close() }, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 50 {
+		if err := d.SetSelection(source); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SetPrimarySelection(source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first roundtrip flushes the events, the second the destroy
+	// requests sent while handling them.
+	for range 2 {
+		if err := c.Roundtrip(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.live(); n != 1 {
+		t.Errorf("%d offers alive in the compositor, want 1", n)
+	}
+	d.mu.Lock()
+	n := len(d.offers)
+	d.mu.Unlock()
+	if n != 1 {
+		t.Errorf("%d offers tracked, want 1", n)
+	}
+	c.hmu.Lock()
+	handlers := len(c.handlers)
+	c.hmu.Unlock()
+	// wl_display, the registry, the device, the source and the offer.
+	if handlers != 5 {
+		t.Errorf("%d handlers, want 5", handlers)
+	}
+}
+
+func TestFinished(t *testing.T) {
+	c, s := start_compositor(t, Global{Interface: "ext_data_control_manager_v1", Version: 1})
+	d, err := NewDataControl(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := make(chan struct{}, 1)
+	d.OnFinished = func() { finished <- struct{}{} }
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Roundtrip(); err != nil {
+		t.Fatal(err)
+	}
+	s.finish()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("OnFinished not called")
+	}
+	if err := c.Roundtrip(); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	devices := len(s.devices)
+	s.mu.Unlock()
+	if devices != 0 {
+		t.Errorf("%d devices left, want the finished one destroyed", devices)
+	}
+	c.hmu.Lock()
+	h := c.handlers[d.device]
+	c.hmu.Unlock()
+	if h != nil {
+		t.Error("the finished device is still handled")
+	}
+}
@@ -0,0 +1,449 @@
+// Package x11 is a minimal client for the X Window System protocol.
+// It only implements the requests needed to own and convert selections,
+// and talks to the X server directly over its socket, so no libX11 is
+// required at build or run time.
+//
+// Protocol reference:
+// https://www.x.org/releases/X11R7.7/doc/xproto/x11protocol.html
+package x11
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var order = binary.LittleEndian
+
+// ErrClosed is returned by requests issued after the connection to the
+// X server has been lost or closed.
+var ErrClosed = errors.New("x11: connection closed")
+
+// Error is an error packet sent back by the X server.
+type Error struct {
+	Code     uint8
+	Sequence uint16
+	BadValue uint32
+	Minor    uint16
+	Major    uint8
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("x11: request %d.%d failed with error %d (bad value 0x%x)", e.Major, e.Minor, e.Code, e.BadValue)
+}
+
+type reply struct {
+	data []byte
+	err  error
+}
+
+// Conn is a connection to an X server. All methods are safe for
+// concurrent use.
+type Conn struct {
+	conn net.Conn
+
+	// Root is the root window of the screen named by the display string.
+	Root uint32
+	// MaxRequestLength is the largest request the server accepts, in bytes.
+	MaxRequestLength int
+
+	id_base uint32
+	id_mask uint32
+
+	wmu     sync.Mutex // guards seq, next_id and writes to conn
+	seq     uint16
+	next_id uint32
+
+	pmu     sync.Mutex // guards pending, events and err
+	pending map[uint16]chan reply
+	events  []Event
+	signal  chan struct{}
+	err     error
+	closed  chan struct{}
+	// first event code of XFixes, zero until it is initialized
+	xfixes_event uint8
+}
+
+// Dial connects to the X server named by display, which has the same
+// syntax as $DISPLAY. An empty display uses $DISPLAY.
+func Dial(display string) (*Conn, error) {
+	if display == "" {
+		display = os.Getenv("DISPLAY")
+	}
+	if display == "" {
+		return nil, errors.New("x11: $DISPLAY is not set")
+	}
+	host, number, screen, err := parse_display(display)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dial_display(host, number)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		conn:    conn,
+		pending: map[uint16]chan reply{},
+		signal:  make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+	if err := c.setup(host, number, screen); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.read_loop()
+	return c, nil
+}
+
+// parse_display splits "host:display.screen" into its components.
+func parse_display(display string) (host string, number string, screen int, err error) {
+	idx := strings.LastIndex(display, ":")
+	if idx < 0 {
+		return "", "", 0, fmt.Errorf("x11: invalid display %q", display)
+	}
+	host = display[:idx]
+	number = display[idx+1:]
+	if dot := strings.Index(number, "."); dot >= 0 {
+		screen, err = strconv.Atoi(number[dot+1:])
+		if err != nil {
+			return "", "", 0, fmt.Errorf("x11: invalid display %q", display)
+		}
+		number = number[:dot]
+	}
+	if _, err := strconv.Atoi(number); err != nil {
+		return "", "", 0, fmt.Errorf("x11: invalid display %q", display)
+	}
+	return host, number, screen, nil
+}
+
+func dial_display(host string, number string) (net.Conn, error) {
+	if host == "" || host == "unix" {
+		path := "/tmp/.X11-unix/X" + number
+		// Prefer the abstract socket, which is what libxcb does on Linux.
+		if conn, err := net.Dial("unix", "@"+path); err == nil {
+			return conn, nil
+		}
+		return net.Dial("unix", path)
+	}
+	n, _ := strconv.Atoi(number)
+	return net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)))
+}
+
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
+
+func (c *Conn) setup(host string, number string, screen int) error {
+	auth_name, auth_data := read_authority(host, number)
+	buf := make([]byte, 12, 12+len(auth_name)+pad(len(auth_name))+len(auth_data)+pad(len(auth_data)))
+	buf[0] = 'l'
+	order.PutUint16(buf[2:], 11)
+	order.PutUint16(buf[4:], 0)
+	order.PutUint16(buf[6:], uint16(len(auth_name)))
+	order.PutUint16(buf[8:], uint16(len(auth_data)))
+	buf = append(buf, auth_name...)
+	buf = append(buf, make([]byte, pad(len(auth_name)))...)
+	buf = append(buf, auth_data...)
+	buf = append(buf, make([]byte, pad(len(auth_data)))...)
+	if _, err := c.conn.Write(buf); err != nil {
+		return err
+	}
+
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(c.conn, head); err != nil {
+		return err
+	}
+	body := make([]byte, int(order.Uint16(head[6:]))*4)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		return err
+	}
+	switch head[0] {
+	case 0:
+		reason := body
+		if int(head[1]) <= len(reason) {
+			reason = reason[:head[1]]
+		}
+		return fmt.Errorf("x11: connection refused: %s", strings.TrimSpace(string(reason)))
+	case 2:
+		return fmt.Errorf("x11: further authentication required: %s", strings.TrimSpace(string(body)))
+	}
+	if len(body) < 32 {
+		return errors.New("x11: short setup reply")
+	}
+	// Offsets below are relative to the end of the 8 byte header.
+	c.id_base = order.Uint32(body[4:])
+	c.id_mask = order.Uint32(body[8:])
+	vendor_len := int(order.Uint16(body[16:]))
+	c.MaxRequestLength = int(order.Uint16(body[18:])) * 4
+	screens := int(body[20])
+	formats := int(body[21])
+	off := 32 + vendor_len + pad(vendor_len) + formats*8
+	if screen >= screens {
+		screen = 0
+	}
+	for i := 0; i <= screen; i++ {
+		if off+40 > len(body) {
+			return errors.New("x11: short setup reply")
+		}
+		if i == screen {
+			c.Root = order.Uint32(body[off:])
+			break
+		}
+		depths := int(body[off+39])
+		off += 40
+		for d := 0; d < depths; d++ {
+			if off+8 > len(body) {
+				return errors.New("x11: short setup reply")
+			}
+			visuals := int(order.Uint16(body[off+2:]))
+			off += 8 + visuals*24
+		}
+	}
+	return nil
+}
+
+// read_authority looks up the MIT-MAGIC-COOKIE-1 for the display in
+// $XAUTHORITY (or ~/.Xauthority). Missing files are not an error, the
+// server may not require authentication at all.
+func read_authority(host string, number string) (name []byte, data []byte) {
+	file := os.Getenv("XAUTHORITY")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		file = home + "/.Xauthority"
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil
+	}
+	if host == "" || host == "unix" || host == "localhost" {
+		host, _ = os.Hostname()
+	}
+	const (
+		family_local = 256
+		family_wild  = 65535
+	)
+	read_field := func() ([]byte, bool) {
+		if len(b) < 2 {
+			return nil, false
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+n {
+			return nil, false
+		}
+		v := b[2 : 2+n]
+		b = b[2+n:]
+		return v, true
+	}
+	for len(b) >= 2 {
+		family := binary.BigEndian.Uint16(b)
+		b = b[2:]
+		address, ok1 := read_field()
+		num, ok2 := read_field()
+		n, ok3 := read_field()
+		d, ok4 := read_field()
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return nil, nil
+		}
+		if family != family_wild && !(family == family_local && string(address) == host) {
+			continue
+		}
+		if len(num) != 0 && string(num) != number {
+			continue
+		}
+		if string(n) != "MIT-MAGIC-COOKIE-1" {
+			continue
+		}
+		return n, d
+	}
+	return nil, nil
+}
+
+// Close closes the connection. Pending and future requests fail with
+// ErrClosed.
+func (c *Conn) Close() error {
+	err := c.conn.Close()
+	c.fail(ErrClosed)
+	return err
+}
+
+// Closed is closed once the connection to the server is gone.
+func (c *Conn) Closed() <-chan struct{} {
+	return c.closed
+}
+
+func (c *Conn) fail(err error) {
+	c.pmu.Lock()
+	defer c.pmu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for seq, ch := range c.pending {
+		ch <- reply{err: err}
+		delete(c.pending, seq)
+	}
+	close(c.closed)
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+}
+
+// NewID allocates a resource id for a window or other server object.
+func (c *Conn) NewID() uint32 {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.next_id++
+	return c.id_base | (c.next_id & c.id_mask)
+}
+
+// send writes a request. When want_reply is true, the returned channel
+// receives the reply or the error generated by the request.
+func (c *Conn) send(req []byte, want_reply bool) (<-chan reply, error) {
+	if len(req)%4 != 0 {
+		panic("x11: request is not 4 byte aligned")
+	}
+	if len(req) > c.MaxRequestLength {
+		return nil, fmt.Errorf("x11: request of %d bytes exceeds the server limit of %d", len(req), c.MaxRequestLength)
+	}
+	order.PutUint16(req[2:], uint16(len(req)/4))
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.pmu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.pmu.Unlock()
+		return nil, err
+	}
+	c.seq++
+	var ch chan reply
+	if want_reply {
+		ch = make(chan reply, 1)
+		c.pending[c.seq] = ch
+	}
+	c.pmu.Unlock()
+	if _, err := c.conn.Write(req); err != nil {
+		c.fail(err)
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (c *Conn) request(req []byte) ([]byte, error) {
+	ch, err := c.send(req, true)
+	if err != nil {
+		return nil, err
+	}
+	r := <-ch
+	return r.data, r.err
+}
+
+// checked sends a request which has no reply and waits until the server
+// has processed it, returning the error it caused, if any.
+func (c *Conn) checked(req []byte) error {
+	ch, err := c.send(req, true)
+	if err != nil {
+		return err
+	}
+	// Errors arrive in request order, before the reply of Sync.
+	sync_err := c.Sync()
+	select {
+	case r := <-ch:
+		return r.err
+	default:
+	}
+	c.pmu.Lock()
+	for seq, p := range c.pending {
+		if p == ch {
+			delete(c.pending, seq)
+		}
+	}
+	c.pmu.Unlock()
+	return sync_err
+}
+
+func (c *Conn) read_loop() {
+	for {
+		buf := make([]byte, 32)
+		if _, err := io.ReadFull(c.conn, buf); err != nil {
+			c.fail(ErrClosed)
+			return
+		}
+		switch buf[0] {
+		case 0:
+			e := &Error{
+				Code:     buf[1],
+				Sequence: order.Uint16(buf[2:]),
+				BadValue: order.Uint32(buf[4:]),
+				Minor:    order.Uint16(buf[8:]),
+				Major:    buf[10],
+			}
+			c.deliver(e.Sequence, reply{err: e})
+		case 1:
+			extra := int(order.Uint32(buf[4:])) * 4
+			if extra > 0 {
+				buf = append(buf, make([]byte, extra)...)
+				if _, err := io.ReadFull(c.conn, buf[32:]); err != nil {
+					c.fail(ErrClosed)
+					return
+				}
+			}
+			c.deliver(order.Uint16(buf[2:]), reply{data: buf})
+		default:
+			c.pmu.Lock()
+			if c.xfixes_event != 0 && buf[0]&0x7f == c.xfixes_event {
+				c.events = append(c.events, parse_xfixes_event(buf))
+			} else {
+				c.events = append(c.events, parse_event(buf))
+			}
+			c.pmu.Unlock()
+			select {
+			case c.signal <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (c *Conn) deliver(seq uint16, r reply) {
+	c.pmu.Lock()
+	defer c.pmu.Unlock()
+	// Replies arrive in request order, so anything older than seq that
+	// is still pending will never get a reply.
+	if ch, ok := c.pending[seq]; ok {
+		ch <- r
+		delete(c.pending, seq)
+	}
+}
+
+// WaitEvent blocks until an event arrives or the connection is closed.
+// Events are queued without limit so that a slow consumer never stalls
+// the delivery of replies.
+func (c *Conn) WaitEvent() (Event, error) {
+	for {
+		c.pmu.Lock()
+		if len(c.events) > 0 {
+			ev := c.events[0]
+			c.events[0] = nil
+			c.events = c.events[1:]
+			c.pmu.Unlock()
+			return ev, nil
+		}
+		err := c.err
+		c.pmu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		<-c.signal
+	}
+}
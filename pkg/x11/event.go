@@ -0,0 +1,114 @@
+package x11
+
+// Event is one of the *Event types below.
+type Event interface{}
+
+// Event codes and masks used by the selection protocol.
+const (
+	PropertyNotify   = 28
+	SelectionClear   = 29
+	SelectionRequest = 30
+	SelectionNotify  = 31
+
+	PropertyChangeMask = 0x00400000
+)
+
+// PropertyNotify states.
+const (
+	PropertyNewValue = 0
+	PropertyDelete   = 1
+)
+
+// PropertyNotifyEvent is sent when a property of a window, that selected
+// PropertyChangeMask, is changed or deleted.
+type PropertyNotifyEvent struct {
+	Window uint32
+	Atom   uint32
+	Time   uint32
+	State  uint8
+}
+
+// SelectionClearEvent is sent to the previous owner of a selection when
+// another client takes it over.
+type SelectionClearEvent struct {
+	Time      uint32
+	Owner     uint32
+	Selection uint32
+}
+
+// SelectionRequestEvent asks the selection owner to convert the
+// selection to Target and store it in Property on Requestor.
+type SelectionRequestEvent struct {
+	Time      uint32
+	Owner     uint32
+	Requestor uint32
+	Selection uint32
+	Target    uint32
+	Property  uint32
+}
+
+// SelectionNotifyEvent answers a ConvertSelection request. Property is
+// None when the conversion was refused.
+type SelectionNotifyEvent struct {
+	Time      uint32
+	Requestor uint32
+	Selection uint32
+	Target    uint32
+	Property  uint32
+}
+
+// UnknownEvent is any event this package does not decode.
+type UnknownEvent struct {
+	Code uint8
+	Data []byte
+}
+
+func parse_event(buf []byte) Event {
+	code := buf[0] & 0x7f
+	switch code {
+	case PropertyNotify:
+		return &PropertyNotifyEvent{
+			Window: order.Uint32(buf[4:]),
+			Atom:   order.Uint32(buf[8:]),
+			Time:   order.Uint32(buf[12:]),
+			State:  buf[16],
+		}
+	case SelectionClear:
+		return &SelectionClearEvent{
+			Time:      order.Uint32(buf[4:]),
+			Owner:     order.Uint32(buf[8:]),
+			Selection: order.Uint32(buf[12:]),
+		}
+	case SelectionRequest:
+		return &SelectionRequestEvent{
+			Time:      order.Uint32(buf[4:]),
+			Owner:     order.Uint32(buf[8:]),
+			Requestor: order.Uint32(buf[12:]),
+			Selection: order.Uint32(buf[16:]),
+			Target:    order.Uint32(buf[20:]),
+			Property:  order.Uint32(buf[24:]),
+		}
+	case SelectionNotify:
+		return &SelectionNotifyEvent{
+			Time:      order.Uint32(buf[4:]),
+			Requestor: order.Uint32(buf[8:]),
+			Selection: order.Uint32(buf[12:]),
+			Target:    order.Uint32(buf[16:]),
+			Property:  order.Uint32(buf[20:]),
+		}
+	}
+	return &UnknownEvent{Code: code, Data: buf}
+}
+
+// encode_selection_notify builds the 32 byte wire form of ev, as sent by
+// selection owners through SendEvent.
+func encode_selection_notify(ev *SelectionNotifyEvent) []byte {
+	buf := make([]byte, 32)
+	buf[0] = SelectionNotify
+	order.PutUint32(buf[4:], ev.Time)
+	order.PutUint32(buf[8:], ev.Requestor)
+	order.PutUint32(buf[12:], ev.Selection)
+	order.PutUint32(buf[16:], ev.Target)
+	order.PutUint32(buf[20:], ev.Property)
+	return buf
+}
@@ -0,0 +1,238 @@
+package x11
+
+import "errors"
+
+// Predefined atoms and special values from the core protocol.
+const (
+	None        = 0
+	CurrentTime = 0
+
+	AtomPrimary   = 1
+	AtomSecondary = 2
+	AtomAtom      = 4
+	AtomInteger   = 19
+	AtomString    = 31
+	AtomWindow    = 33
+)
+
+// ChangeProperty modes.
+const (
+	PropModeReplace = 0
+	PropModePrepend = 1
+	PropModeAppend  = 2
+)
+
+func new_request(opcode uint8, data uint8, size int) []byte {
+	buf := make([]byte, size)
+	buf[0] = opcode
+	buf[1] = data
+	return buf
+}
+
+func append_string(buf []byte, s string) []byte {
+	buf = append(buf, s...)
+	return append(buf, make([]byte, pad(len(s)))...)
+}
+
+// CreateWindow creates an unmapped InputOnly window, which is all that is
+// needed to take part in selection transfers. event_mask selects the
+// events delivered for the window.
+func (c *Conn) CreateWindow(event_mask uint32) (uint32, error) {
+	id := c.NewID()
+	req := new_request(1, 0, 36)
+	order.PutUint32(req[4:], id)
+	order.PutUint32(req[8:], c.Root)
+	order.PutUint16(req[16:], 1) // width
+	order.PutUint16(req[18:], 1) // height
+	order.PutUint16(req[22:], 2) // InputOnly
+	order.PutUint32(req[28:], 0x800)
+	order.PutUint32(req[32:], event_mask)
+	_, err := c.send(req, false)
+	return id, err
+}
+
+// SelectInput changes the event mask of window.
+func (c *Conn) SelectInput(window uint32, event_mask uint32) error {
+	req := new_request(2, 0, 16)
+	order.PutUint32(req[4:], window)
+	order.PutUint32(req[8:], 0x800)
+	order.PutUint32(req[12:], event_mask)
+	_, err := c.send(req, false)
+	return err
+}
+
+// DestroyWindow destroys window.
+func (c *Conn) DestroyWindow(window uint32) error {
+	req := new_request(4, 0, 8)
+	order.PutUint32(req[4:], window)
+	_, err := c.send(req, false)
+	return err
+}
+
+// InternAtom returns the atom for name. When only_if_exists is true and
+// the atom does not exist yet, None is returned.
+func (c *Conn) InternAtom(name string, only_if_exists bool) (uint32, error) {
+	var flag uint8
+	if only_if_exists {
+		flag = 1
+	}
+	req := new_request(16, flag, 8)
+	order.PutUint16(req[4:], uint16(len(name)))
+	req = append_string(req, name)
+	r, err := c.request(req)
+	if err != nil {
+		return None, err
+	}
+	return order.Uint32(r[8:]), nil
+}
+
+// GetAtomName returns the name of atom.
+func (c *Conn) GetAtomName(atom uint32) (string, error) {
+	req := new_request(17, 0, 8)
+	order.PutUint32(req[4:], atom)
+	r, err := c.request(req)
+	if err != nil {
+		return "", err
+	}
+	n := int(order.Uint16(r[8:]))
+	if 32+n > len(r) {
+		return "", errors.New("x11: short GetAtomName reply")
+	}
+	return string(r[32 : 32+n]), nil
+}
+
+// ChangeProperty sets property on window. format is 8, 16 or 32 and data
+// must hold a whole number of items of that size.
+func (c *Conn) ChangeProperty(mode uint8, window uint32, property uint32, typ uint32, format uint8, data []byte) error {
+	req := new_request(18, mode, 24)
+	order.PutUint32(req[4:], window)
+	order.PutUint32(req[8:], property)
+	order.PutUint32(req[12:], typ)
+	req[16] = format
+	order.PutUint32(req[20:], uint32(len(data)/(int(format)/8)))
+	req = append(req, data...)
+	req = append(req, make([]byte, pad(len(data)))...)
+	_, err := c.send(req, false)
+	return err
+}
+
+// MaxPropertySize is the largest payload that fits in one ChangeProperty
+// request. Bigger values have to be transferred with the INCR protocol.
+func (c *Conn) MaxPropertySize() int {
+	return (c.MaxRequestLength - 24) &^ 3
+}
+
+// DeleteProperty removes property from window.
+func (c *Conn) DeleteProperty(window uint32, property uint32) error {
+	req := new_request(19, 0, 12)
+	order.PutUint32(req[4:], window)
+	order.PutUint32(req[8:], property)
+	_, err := c.send(req, false)
+	return err
+}
+
+// PropertyReply is the result of GetProperty.
+type PropertyReply struct {
+	Type       uint32
+	Format     uint8
+	BytesAfter uint32
+	Value      []byte
+}
+
+// GetProperty reads up to length 4-byte units of property, starting at
+// the 4-byte offset. When delete is true and the whole value was read,
+// the property is deleted.
+func (c *Conn) GetProperty(delete bool, window uint32, property uint32, offset uint32, length uint32) (*PropertyReply, error) {
+	var flag uint8
+	if delete {
+		flag = 1
+	}
+	req := new_request(20, flag, 24)
+	order.PutUint32(req[4:], window)
+	order.PutUint32(req[8:], property)
+	order.PutUint32(req[12:], 0) // AnyPropertyType
+	order.PutUint32(req[16:], offset)
+	order.PutUint32(req[20:], length)
+	r, err := c.request(req)
+	if err != nil {
+		return nil, err
+	}
+	p := &PropertyReply{
+		Format:     r[1],
+		Type:       order.Uint32(r[8:]),
+		BytesAfter: order.Uint32(r[12:]),
+	}
+	n := int(order.Uint32(r[16:])) * int(p.Format) / 8
+	if 32+n > len(r) {
+		return nil, errors.New("x11: short GetProperty reply")
+	}
+	p.Value = r[32 : 32+n]
+	return p, nil
+}
+
+// SetSelectionOwner makes owner the owner of selection. Passing None
+// disowns the selection.
+func (c *Conn) SetSelectionOwner(owner uint32, selection uint32, time uint32) error {
+	req := new_request(22, 0, 16)
+	order.PutUint32(req[4:], owner)
+	order.PutUint32(req[8:], selection)
+	order.PutUint32(req[12:], time)
+	_, err := c.send(req, false)
+	return err
+}
+
+// GetSelectionOwner returns the window owning selection, or None.
+func (c *Conn) GetSelectionOwner(selection uint32) (uint32, error) {
+	req := new_request(23, 0, 8)
+	order.PutUint32(req[4:], selection)
+	r, err := c.request(req)
+	if err != nil {
+		return None, err
+	}
+	return order.Uint32(r[8:]), nil
+}
+
+// ConvertSelection asks the owner of selection to store it as target in
+// property on requestor. The answer arrives as a SelectionNotifyEvent.
+func (c *Conn) ConvertSelection(requestor uint32, selection uint32, target uint32, property uint32, time uint32) error {
+	req := new_request(24, 0, 24)
+	order.PutUint32(req[4:], requestor)
+	order.PutUint32(req[8:], selection)
+	order.PutUint32(req[12:], target)
+	order.PutUint32(req[16:], property)
+	order.PutUint32(req[20:], time)
+	_, err := c.send(req, false)
+	return err
+}
+
+// SendSelectionNotify delivers ev to its requestor, completing a
+// selection conversion.
+func (c *Conn) SendSelectionNotify(ev *SelectionNotifyEvent) error {
+	req := new_request(25, 0, 12)
+	order.PutUint32(req[4:], ev.Requestor)
+	order.PutUint32(req[8:], 0) // no event mask, deliver to the client that created the window
+	req = append(req, encode_selection_notify(ev)...)
+	_, err := c.send(req, false)
+	return err
+}
+
+// Sync waits until the server has processed every request sent so far.
+// Errors caused by earlier requests are not reported.
+func (c *Conn) Sync() error {
+	req := new_request(43, 0, 4) // GetInputFocus
+	_, err := c.request(req)
+	return err
+}
+
+// QueryExtension reports whether the server supports extension name and
+// returns its major opcode and first event code.
+func (c *Conn) QueryExtension(name string) (present bool, major uint8, first_event uint8, err error) {
+	req := new_request(98, 0, 8)
+	order.PutUint16(req[4:], uint16(len(name)))
+	req = append_string(req, name)
+	r, err := c.request(req)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return r[8] != 0, r[9], r[10], nil
+}
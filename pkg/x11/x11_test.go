@@ -0,0 +1,328 @@
+//go:build linux
+
+package x11
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ltaoo/clipboard-go/pkg/x11/x11test"
+)
+
+func serve(t *testing.T, opts x11test.Options) *x11test.Server {
+	t.Helper()
+	t.Setenv("XAUTHORITY", t.TempDir()+"/none")
+	srv, err := x11test.NewServer(opts)
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func dial(t *testing.T, srv *x11test.Server) *Conn {
+	t.Helper()
+	c, err := Dial(srv.Display)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// wait_event returns the next event of c, failing after a second.
+func wait_event(t *testing.T, c *Conn) Event {
+	t.Helper()
+	ch := make(chan Event, 1)
+	go func() {
+		ev, _ := c.WaitEvent()
+		ch <- ev
+	}()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return nil
+}
+
+func TestParseDisplay(t *testing.T) {
+	for _, c := range []struct {
+		display, host, number string
+		screen                int
+	}{
+		{":0", "", "0", 0},
+		{":1.2", "", "1", 2},
+		{"unix:3", "unix", "3", 0},
+		{"localhost:10.0", "localhost", "10", 0},
+		{"[::1]:4", "[::1]", "4", 0},
+	} {
+		host, number, screen, err := parse_display(c.display)
+		if err != nil || host != c.host || number != c.number || screen != c.screen {
+			t.Errorf("parse_display(%q) = %q, %q, %d, %v", c.display, host, number, screen, err)
+		}
+	}
+	for _, display := range []string{"", "0", ":x", ":0.y"} {
+		if _, _, _, err := parse_display(display); err == nil {
+			t.Errorf("parse_display(%q) succeeded", display)
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	srv := serve(t, x11test.Options{MaxRequestLength: 4096})
+	c := dial(t, srv)
+	if c.Root != x11test.Root {
+		t.Errorf("Root = %#x", c.Root)
+	}
+	if c.MaxRequestLength != 4096 || c.MaxPropertySize() != 4072 {
+		t.Errorf("MaxRequestLength = %d, MaxPropertySize = %d", c.MaxRequestLength, c.MaxPropertySize())
+	}
+	if a, b := c.NewID(), c.NewID(); a == b || a&^0x1fffff != b&^0x1fffff {
+		t.Errorf("NewID = %#x, %#x", a, b)
+	}
+}
+
+func TestInternAtom(t *testing.T) {
+	srv := serve(t, x11test.Options{})
+	c := dial(t, srv)
+	if a, err := c.InternAtom("MISSING", true); err != nil || a != None {
+		t.Errorf("InternAtom(only_if_exists) = %d, %v", a, err)
+	}
+	a, err := c.InternAtom("UTF8_STRING", false)
+	if err != nil || a == None {
+		t.Fatalf("InternAtom = %d, %v", a, err)
+	}
+	if b, _ := c.InternAtom("UTF8_STRING", true); b != a {
+		t.Errorf("InternAtom again = %d, want %d", b, a)
+	}
+	if name, err := c.GetAtomName(a); err != nil || name != "UTF8_STRING" {
+		t.Errorf("GetAtomName = %q, %v", name, err)
+	}
+	if name, err := c.GetAtomName(AtomString); err != nil || name != "STRING" {
+		t.Errorf("GetAtomName(STRING) = %q, %v", name, err)
+	}
+	var x *Error
+	if _, err := c.GetAtomName(9999); !errors.As(err, &x) || x.Major != 17 || x.BadValue != 9999 {
+		t.Errorf("GetAtomName(9999) = %v", err)
+	}
+	// The wire form of the second request: opcode, only_if_exists,
+	// length in units, name length, the name padded to 4 bytes.
+	req := srv.Requests()[1]
+	want := []byte{16, 0, 5, 0, 11, 0, 0, 0, 'U', 'T', 'F', '8', '_', 'S', 'T', 'R', 'I', 'N', 'G', 0}
+	if !bytes.Equal(req, want) {
+		t.Errorf("InternAtom request = %v, want %v", req, want)
+	}
+}
+
+func TestProperty(t *testing.T) {
+	srv := serve(t, x11test.Options{})
+	c := dial(t, srv)
+	w, err := c.CreateWindow(PropertyChangeMask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prop, _ := c.InternAtom("DATA", false)
+	if err := c.ChangeProperty(PropModeReplace, w, prop, AtomString, 8, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ChangeProperty(PropModeAppend, w, prop, AtomString, 8, []byte(", world")); err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []uint8{PropertyNewValue, PropertyNewValue} {
+		ev, ok := wait_event(t, c).(*PropertyNotifyEvent)
+		if !ok || ev.Window != w || ev.Atom != prop || ev.State != state {
+			t.Errorf("event = %+v", ev)
+		}
+	}
+	// 5 bytes padded to 8 in the request.
+	req := srv.Requests()[2]
+	if len(req) != 32 || req[16] != 8 || order.Uint32(req[20:]) != 5 || string(req[24:29]) != "hello" {
+		t.Errorf("ChangeProperty request = %v", req)
+	}
+
+	p, err := c.GetProperty(false, w, prop, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != AtomString || p.Format != 8 || string(p.Value) != "o, w" || p.BytesAfter != 4 {
+		t.Errorf("GetProperty(1, 1) = %+v", p)
+	}
+	p, err = c.GetProperty(true, w, prop, 0, 100)
+	if err != nil || string(p.Value) != "hello, world" || p.BytesAfter != 0 {
+		t.Fatalf("GetProperty = %+v, %v", p, err)
+	}
+	if ev, ok := wait_event(t, c).(*PropertyNotifyEvent); !ok || ev.State != PropertyDelete {
+		t.Errorf("event = %+v", ev)
+	}
+	p, err = c.GetProperty(false, w, prop, 0, 100)
+	if err != nil || p.Type != None || len(p.Value) != 0 {
+		t.Errorf("GetProperty deleted = %+v, %v", p, err)
+	}
+
+	atoms := []byte{1, 0, 0, 0, 4, 0, 0, 0}
+	if err := c.ChangeProperty(PropModeReplace, w, prop, AtomAtom, 32, atoms); err != nil {
+		t.Fatal(err)
+	}
+	p, err = c.GetProperty(false, w, prop, 0, 100)
+	if err != nil || p.Format != 32 || !bytes.Equal(p.Value, atoms) {
+		t.Errorf("GetProperty format 32 = %+v, %v", p, err)
+	}
+	if err := c.DeleteProperty(w, prop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetProperty(false, 12345, prop, 0, 1); err == nil {
+		t.Error("GetProperty of a missing window succeeded")
+	}
+}
+
+func TestRequestTooLarge(t *testing.T) {
+	srv := serve(t, x11test.Options{MaxRequestLength: 64})
+	c := dial(t, srv)
+	w, _ := c.CreateWindow(0)
+	err := c.ChangeProperty(PropModeReplace, w, AtomString, AtomString, 8, make([]byte, c.MaxPropertySize()+4))
+	if err == nil {
+		t.Error("ChangeProperty beyond the limit succeeded")
+	}
+	if err := c.ChangeProperty(PropModeReplace, w, AtomString, AtomString, 8, make([]byte, c.MaxPropertySize())); err != nil {
+		t.Error(err)
+	}
+	if err := c.Sync(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSelection(t *testing.T) {
+	srv := serve(t, x11test.Options{})
+	owner, requestor := dial(t, srv), dial(t, srv)
+	ow, _ := owner.CreateWindow(0)
+	rw, _ := requestor.CreateWindow(0)
+	clipboard, _ := owner.InternAtom("CLIPBOARD", false)
+	target, _ := owner.InternAtom("UTF8_STRING", false)
+	prop, _ := requestor.InternAtom("DATA", false)
+
+	if err := owner.SetSelectionOwner(ow, clipboard, 100); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := requestor.GetSelectionOwner(clipboard); err != nil || got != ow {
+		t.Fatalf("GetSelectionOwner = %#x, %v", got, err)
+	}
+	if err := requestor.ConvertSelection(rw, clipboard, target, prop, 200); err != nil {
+		t.Fatal(err)
+	}
+	req, ok := wait_event(t, owner).(*SelectionRequestEvent)
+	want := &SelectionRequestEvent{Time: 200, Owner: ow, Requestor: rw, Selection: clipboard, Target: target, Property: prop}
+	if !ok || !reflect.DeepEqual(req, want) {
+		t.Fatalf("SelectionRequest = %+v, want %+v", req, want)
+	}
+	owner.ChangeProperty(PropModeReplace, rw, prop, target, 8, []byte("copied"))
+	notify := &SelectionNotifyEvent{Time: 200, Requestor: rw, Selection: clipboard, Target: target, Property: prop}
+	if err := owner.SendSelectionNotify(notify); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := wait_event(t, requestor).(*SelectionNotifyEvent); !ok || !reflect.DeepEqual(got, notify) {
+		t.Fatalf("SelectionNotify = %+v, want %+v", got, notify)
+	}
+	if p, err := requestor.GetProperty(true, rw, prop, 0, 100); err != nil || string(p.Value) != "copied" {
+		t.Errorf("GetProperty = %+v, %v", p, err)
+	}
+
+	if err := requestor.SetSelectionOwner(rw, clipboard, 300); err != nil {
+		t.Fatal(err)
+	}
+	clear := &SelectionClearEvent{Time: 300, Owner: ow, Selection: clipboard}
+	if got, ok := wait_event(t, owner).(*SelectionClearEvent); !ok || !reflect.DeepEqual(got, clear) {
+		t.Errorf("SelectionClear = %+v, want %+v", got, clear)
+	}
+
+	// Without an owner the server refuses the conversion itself.
+	requestor.SetSelectionOwner(None, clipboard, CurrentTime)
+	if got, ok := wait_event(t, requestor).(*SelectionClearEvent); !ok || got.Owner != rw {
+		t.Errorf("SelectionClear on disowning = %+v", got)
+	}
+	requestor.ConvertSelection(rw, clipboard, target, prop, CurrentTime)
+	if got, ok := wait_event(t, requestor).(*SelectionNotifyEvent); !ok || got.Property != None {
+		t.Errorf("refused SelectionNotify = %+v", got)
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	buf := make([]byte, 32)
+	buf[0] = 0x80 | SelectionNotify // sent by SendEvent
+	order.PutUint32(buf[4:], 1)
+	order.PutUint32(buf[8:], 2)
+	order.PutUint32(buf[12:], 3)
+	order.PutUint32(buf[16:], 4)
+	order.PutUint32(buf[20:], 5)
+	want := &SelectionNotifyEvent{Time: 1, Requestor: 2, Selection: 3, Target: 4, Property: 5}
+	if got := parse_event(buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("parse_event = %+v", got)
+	}
+	buf[0] = SelectionNotify
+	if got := encode_selection_notify(want); !bytes.Equal(got, buf) {
+		t.Errorf("encode_selection_notify = %v, want %v", got, buf)
+	}
+	buf[0] = 12 // Expose
+	if got, ok := parse_event(buf).(*UnknownEvent); !ok || got.Code != 12 {
+		t.Errorf("parse_event(Expose) = %+v", got)
+	}
+}
+
+func TestXFixes(t *testing.T) {
+	srv := serve(t, x11test.Options{XFixes: true})
+	c, other := dial(t, srv), dial(t, srv)
+	w, _ := c.CreateWindow(0)
+	ow, _ := other.CreateWindow(0)
+	clipboard, _ := c.InternAtom("CLIPBOARD", false)
+	x, err := c.XFixes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var xerr *Error
+	if err := x.SelectSelectionInput(12345, clipboard, XFixesSetSelectionOwnerNotifyMask); !errors.As(err, &xerr) || xerr.Code != x11test.BadWindow {
+		t.Errorf("SelectSelectionInput on a missing window = %v", err)
+	}
+	mask := uint32(XFixesSetSelectionOwnerNotifyMask | XFixesSelectionClientCloseNotifyMask)
+	if err := x.SelectSelectionInput(w, clipboard, mask); err != nil {
+		t.Fatal(err)
+	}
+	other.SetSelectionOwner(ow, clipboard, 500)
+	ev, ok := wait_event(t, c).(*XFixesSelectionNotifyEvent)
+	if !ok || ev.Subtype != XFixesSetSelectionOwnerNotify || ev.Window != w || ev.Owner != ow || ev.Selection != clipboard || ev.SelectionTimestamp != 500 {
+		t.Fatalf("XFixesSelectionNotify = %+v", ev)
+	}
+	other.Close()
+	ev, ok = wait_event(t, c).(*XFixesSelectionNotifyEvent)
+	if !ok || ev.Subtype != XFixesSelectionClientCloseNotify || ev.Owner != None {
+		t.Errorf("XFixesSelectionNotify on close = %+v", ev)
+	}
+}
+
+func TestNoXFixes(t *testing.T) {
+	srv := serve(t, x11test.Options{})
+	c := dial(t, srv)
+	if _, err := c.XFixes(); !errors.Is(err, ErrNoXFixes) {
+		t.Errorf("XFixes = %v", err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	srv := serve(t, x11test.Options{})
+	c := dial(t, srv)
+	srv.Close()
+	select {
+	case <-c.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("Closed not closed")
+	}
+	if _, err := c.InternAtom("A", false); !errors.Is(err, ErrClosed) {
+		t.Errorf("InternAtom = %v", err)
+	}
+	if _, err := c.WaitEvent(); !errors.Is(err, ErrClosed) {
+		t.Errorf("WaitEvent = %v", err)
+	}
+}
@@ -0,0 +1,529 @@
+//go:build linux
+
+// Package x11test runs an in-process X server for tests of X clients,
+// so they run without a display:
+//
+//	srv, err := x11test.NewServer(x11test.Options{XFixes: true})
+//	if err != nil {
+//		t.Skip(err)
+//	}
+//	defer srv.Close()
+//	conn, err := x11.Dial(srv.Display)
+//
+// It implements the few requests of the selection protocol that the x11
+// package sends: windows, atoms, properties, selections, SendEvent and
+// the selection tracking of XFixes. Requests it does not know fail with
+// BadRequest. The server listens on an abstract socket, which only
+// Linux has.
+package x11test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+var order = binary.LittleEndian
+
+// Options configures a Server.
+type Options struct {
+	// XFixes offers the XFixes extension.
+	XFixes bool
+	// MaxRequestLength is the largest request accepted, in bytes, 65535
+	// units of 4 bytes if zero.
+	MaxRequestLength int
+}
+
+// Error codes sent by the server.
+const (
+	BadRequest = 1
+	BadWindow  = 3
+	BadLength  = 16
+)
+
+// The major opcode and the first event code of XFixes.
+const (
+	XFixesMajor = 140
+	XFixesEvent = 90
+)
+
+// Root is the id of the root window.
+const Root = 0x100
+
+// Server is a fake X server, safe for concurrent use.
+type Server struct {
+	// Display is the display string to dial the server with.
+	Display string
+
+	opts Options
+	l    net.Listener
+
+	mu        sync.Mutex
+	atoms     map[string]uint32
+	names     map[uint32]string
+	windows   map[uint32]*window
+	owners    map[uint32]uint32 // selection -> owner window
+	times     map[uint32]uint32 // selection -> time it was set
+	xfixes    map[*client]map[uint32]uint32
+	clients   map[*client]struct{}
+	next_base uint32
+	now       uint32
+	requests  [][]byte
+}
+
+type property struct {
+	typ    uint32
+	format uint8
+	data   []byte
+}
+
+type window struct {
+	id     uint32
+	client *client
+	masks  map[*client]uint32
+	props  map[uint32]*property
+}
+
+type client struct {
+	conn net.Conn
+	base uint32
+	seq  uint16
+	wmu  sync.Mutex
+}
+
+// NewServer starts a server on the first free display number from 1000
+// on.
+func NewServer(opts Options) (*Server, error) {
+	if opts.MaxRequestLength == 0 {
+		opts.MaxRequestLength = 65535 * 4
+	}
+	s := &Server{
+		opts:      opts,
+		atoms:     map[string]uint32{},
+		names:     map[uint32]string{},
+		windows:   map[uint32]*window{},
+		owners:    map[uint32]uint32{},
+		times:     map[uint32]uint32{},
+		xfixes:    map[*client]map[uint32]uint32{},
+		clients:   map[*client]struct{}{},
+		next_base: 0x200000,
+		now:       1000,
+	}
+	predefined := map[uint32]string{1: "PRIMARY", 2: "SECONDARY", 4: "ATOM", 19: "INTEGER", 31: "STRING", 33: "WINDOW"}
+	for a, n := range predefined {
+		s.atoms[n] = a
+		s.names[a] = n
+	}
+	s.windows[Root] = &window{id: Root, masks: map[*client]uint32{}, props: map[uint32]*property{}}
+	var err error
+	for n := 1000 + os.Getpid()%1000; n < 3000; n++ {
+		s.l, err = net.Listen("unix", "@/tmp/.X11-unix/X"+strconv.Itoa(n))
+		if err == nil {
+			s.Display = ":" + strconv.Itoa(n)
+			go s.accept()
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("x11test: %w", err)
+}
+
+// Close stops the server and drops its clients.
+func (s *Server) Close() error {
+	err := s.l.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	return err
+}
+
+// Requests returns the requests received so far, in order.
+func (s *Server) Requests() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.requests...)
+}
+
+// Owner returns the window owning selection, which is named by its
+// atom name, or 0.
+func (s *Server) Owner(selection string) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.owners[s.atoms[selection]]
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+func (c *client) send(b []byte) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.Write(b)
+}
+
+// event sends ev to c, with the sequence number of its last request.
+func (c *client) event(ev []byte) {
+	order.PutUint16(ev[2:], c.seq)
+	c.send(ev)
+}
+
+func (c *client) reply(data uint8, extra []byte) {
+	r := make([]byte, 32)
+	r[0] = 1
+	r[1] = data
+	order.PutUint16(r[2:], c.seq)
+	var tail []byte
+	if len(extra) > 24 {
+		copy(r[8:], extra[:24])
+		tail = extra[24:]
+		tail = append(tail, make([]byte, (4-len(tail)%4)%4)...)
+	} else {
+		copy(r[8:], extra)
+	}
+	order.PutUint32(r[4:], uint32(len(tail)/4))
+	c.send(append(r, tail...))
+}
+
+func (c *client) error(code uint8, major uint8, bad uint32) {
+	e := make([]byte, 32)
+	e[1] = code
+	order.PutUint16(e[2:], c.seq)
+	order.PutUint32(e[4:], bad)
+	e[10] = major
+	c.send(e)
+}
+
+func (s *Server) tick() uint32 {
+	s.now += 10
+	return s.now
+}
+
+func (s *Server) intern(name string) uint32 {
+	if a, ok := s.atoms[name]; ok {
+		return a
+	}
+	a := uint32(len(s.atoms) + 100)
+	s.atoms[name] = a
+	s.names[a] = name
+	return a
+}
+
+func (s *Server) serve(conn net.Conn) {
+	c := &client{conn: conn}
+	defer conn.Close()
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	n := int(order.Uint16(head[6:]))
+	d := int(order.Uint16(head[8:]))
+	if _, err := io.ReadFull(conn, make([]byte, n+(4-n%4)%4+d+(4-d%4)%4)); err != nil {
+		return
+	}
+	s.mu.Lock()
+	c.base = s.next_base
+	s.next_base += 0x200000
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	defer s.drop(c)
+
+	const vendor = "x11test"
+	body := make([]byte, 32)
+	order.PutUint32(body[4:], c.base)
+	order.PutUint32(body[8:], 0x1fffff)
+	order.PutUint16(body[16:], uint16(len(vendor)))
+	order.PutUint16(body[18:], uint16(s.opts.MaxRequestLength/4))
+	body[20] = 1 // screens
+	body = append(body, vendor...)
+	body = append(body, make([]byte, (4-len(vendor)%4)%4)...)
+	screen := make([]byte, 40)
+	order.PutUint32(screen, Root)
+	body = append(body, screen...)
+	setup := make([]byte, 8)
+	setup[0] = 1
+	order.PutUint16(setup[2:], 11)
+	order.PutUint16(setup[6:], uint16(len(body)/4))
+	c.send(append(setup, body...))
+
+	for {
+		h := make([]byte, 4)
+		if _, err := io.ReadFull(conn, h); err != nil {
+			return
+		}
+		n := int(order.Uint16(h[2:])) * 4
+		if n < 4 {
+			return
+		}
+		req := append(h, make([]byte, n-4)...)
+		if _, err := io.ReadFull(conn, req[4:]); err != nil {
+			return
+		}
+		s.mu.Lock()
+		c.seq++
+		s.requests = append(s.requests, req)
+		if len(req) > s.opts.MaxRequestLength {
+			c.error(BadLength, req[0], 0)
+		} else {
+			s.handle(c, req)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// drop forgets the windows of c and the selections they own.
+func (s *Server) drop(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, c)
+	delete(s.xfixes, c)
+	for id, w := range s.windows {
+		delete(w.masks, c)
+		if w.client != c {
+			continue
+		}
+		delete(s.windows, id)
+		for sel, owner := range s.owners {
+			if owner == id {
+				delete(s.owners, sel)
+				s.notify_xfixes(sel, 0, 2) // SelectionClientCloseNotify
+			}
+		}
+	}
+}
+
+func (s *Server) property_notify(w *window, atom uint32, state uint8) {
+	t := s.tick()
+	for c, mask := range w.masks {
+		if mask&0x400000 == 0 {
+			continue
+		}
+		ev := make([]byte, 32)
+		ev[0] = 28
+		order.PutUint32(ev[4:], w.id)
+		order.PutUint32(ev[8:], atom)
+		order.PutUint32(ev[12:], t)
+		ev[16] = state
+		c.event(ev)
+	}
+}
+
+func (s *Server) notify_xfixes(selection uint32, owner uint32, subtype uint8) {
+	t := s.tick()
+	for c, selected := range s.xfixes {
+		w, ok := selected[selection]
+		if !ok {
+			continue
+		}
+		ev := make([]byte, 32)
+		ev[0] = XFixesEvent
+		ev[1] = subtype
+		order.PutUint32(ev[4:], w)
+		order.PutUint32(ev[8:], owner)
+		order.PutUint32(ev[12:], selection)
+		order.PutUint32(ev[16:], t)
+		order.PutUint32(ev[20:], s.times[selection])
+		c.event(ev)
+	}
+}
+
+func (s *Server) handle(c *client, req []byte) {
+	switch req[0] {
+	case 1: // CreateWindow
+		id := order.Uint32(req[4:])
+		w := &window{id: id, client: c, masks: map[*client]uint32{}, props: map[uint32]*property{}}
+		if order.Uint32(req[28:])&0x800 != 0 {
+			w.masks[c] = order.Uint32(req[32:])
+		}
+		s.windows[id] = w
+	case 2: // ChangeWindowAttributes
+		w := s.windows[order.Uint32(req[4:])]
+		if w == nil {
+			c.error(BadWindow, req[0], order.Uint32(req[4:]))
+			return
+		}
+		if order.Uint32(req[8:])&0x800 != 0 {
+			w.masks[c] = order.Uint32(req[12:])
+		}
+	case 4: // DestroyWindow
+		delete(s.windows, order.Uint32(req[4:]))
+	case 16: // InternAtom
+		name := string(req[8 : 8+order.Uint16(req[4:])])
+		a := s.atoms[name]
+		if req[1] == 0 {
+			a = s.intern(name)
+		}
+		c.reply(0, order.AppendUint32(nil, a))
+	case 17: // GetAtomName
+		name, ok := s.names[order.Uint32(req[4:])]
+		if !ok {
+			c.error(5, req[0], order.Uint32(req[4:])) // BadAtom
+			return
+		}
+		extra := make([]byte, 24)
+		order.PutUint16(extra, uint16(len(name)))
+		c.reply(0, append(extra, name...))
+	case 18: // ChangeProperty
+		w := s.windows[order.Uint32(req[4:])]
+		if w == nil {
+			c.error(BadWindow, req[0], order.Uint32(req[4:]))
+			return
+		}
+		atom := order.Uint32(req[8:])
+		format := req[16]
+		n := int(order.Uint32(req[20:])) * int(format) / 8
+		data := append([]byte(nil), req[24:24+n]...)
+		if p := w.props[atom]; req[1] == 2 && p != nil {
+			p.data = append(p.data, data...)
+		} else {
+			w.props[atom] = &property{typ: order.Uint32(req[12:]), format: format, data: data}
+		}
+		s.property_notify(w, atom, 0)
+	case 19: // DeleteProperty
+		w := s.windows[order.Uint32(req[4:])]
+		if w == nil {
+			c.error(BadWindow, req[0], order.Uint32(req[4:]))
+			return
+		}
+		atom := order.Uint32(req[8:])
+		if _, ok := w.props[atom]; ok {
+			delete(w.props, atom)
+			s.property_notify(w, atom, 1)
+		}
+	case 20: // GetProperty
+		w := s.windows[order.Uint32(req[4:])]
+		if w == nil {
+			c.error(BadWindow, req[0], order.Uint32(req[4:]))
+			return
+		}
+		atom := order.Uint32(req[8:])
+		extra := make([]byte, 24)
+		p := w.props[atom]
+		if p == nil {
+			c.reply(0, extra)
+			return
+		}
+		off := min(int(order.Uint32(req[16:]))*4, len(p.data))
+		end := min(off+int(order.Uint32(req[20:]))*4, len(p.data))
+		value := p.data[off:end]
+		order.PutUint32(extra[0:], p.typ)
+		order.PutUint32(extra[4:], uint32(len(p.data)-end))
+		order.PutUint32(extra[8:], uint32(len(value)/(int(p.format)/8)))
+		c.reply(p.format, append(extra, value...))
+		if req[1] == 1 && end == len(p.data) {
+			delete(w.props, atom)
+			s.property_notify(w, atom, 1)
+		}
+	case 22: // SetSelectionOwner
+		owner := order.Uint32(req[4:])
+		sel := order.Uint32(req[8:])
+		t := order.Uint32(req[12:])
+		if t == 0 {
+			t = s.tick()
+		}
+		if old := s.owners[sel]; old != 0 && old != owner {
+			if w := s.windows[old]; w != nil {
+				ev := make([]byte, 32)
+				ev[0] = 29
+				order.PutUint32(ev[4:], t)
+				order.PutUint32(ev[8:], old)
+				order.PutUint32(ev[12:], sel)
+				w.client.event(ev)
+			}
+		}
+		if owner == 0 {
+			delete(s.owners, sel)
+		} else {
+			s.owners[sel] = owner
+		}
+		s.times[sel] = t
+		s.notify_xfixes(sel, owner, 0)
+	case 23: // GetSelectionOwner
+		c.reply(0, order.AppendUint32(nil, s.owners[order.Uint32(req[4:])]))
+	case 24: // ConvertSelection
+		requestor := order.Uint32(req[4:])
+		sel := order.Uint32(req[8:])
+		target := order.Uint32(req[12:])
+		t := order.Uint32(req[20:])
+		ev := make([]byte, 32)
+		order.PutUint32(ev[4:], t)
+		if w := s.windows[s.owners[sel]]; w != nil {
+			ev[0] = 30
+			order.PutUint32(ev[8:], w.id)
+			order.PutUint32(ev[12:], requestor)
+			order.PutUint32(ev[16:], sel)
+			order.PutUint32(ev[20:], target)
+			order.PutUint32(ev[24:], order.Uint32(req[16:]))
+			w.client.event(ev)
+			return
+		}
+		if w := s.windows[requestor]; w != nil {
+			ev[0] = 31
+			order.PutUint32(ev[8:], requestor)
+			order.PutUint32(ev[12:], sel)
+			order.PutUint32(ev[16:], target)
+			w.client.event(ev)
+		}
+	case 25: // SendEvent
+		w := s.windows[order.Uint32(req[4:])]
+		if w == nil {
+			c.error(BadWindow, req[0], order.Uint32(req[4:]))
+			return
+		}
+		ev := append([]byte(nil), req[12:44]...)
+		ev[0] |= 0x80
+		w.client.event(ev)
+	case 43: // GetInputFocus
+		c.reply(0, make([]byte, 4))
+	case 98: // QueryExtension
+		name := string(req[8 : 8+order.Uint16(req[4:])])
+		extra := make([]byte, 4)
+		if name == "XFIXES" && s.opts.XFixes {
+			extra[0] = 1
+			extra[1] = XFixesMajor
+			extra[2] = XFixesEvent
+		}
+		c.reply(0, extra)
+	case XFixesMajor:
+		if !s.opts.XFixes {
+			c.error(BadRequest, req[0], 0)
+			return
+		}
+		switch req[1] {
+		case 0: // QueryVersion
+			extra := make([]byte, 8)
+			order.PutUint32(extra, 5)
+			c.reply(0, extra)
+		case 2: // SelectSelectionInput
+			w := order.Uint32(req[4:])
+			if s.windows[w] == nil {
+				c.error(BadWindow, req[0], w)
+				return
+			}
+			sel := order.Uint32(req[8:])
+			if s.xfixes[c] == nil {
+				s.xfixes[c] = map[uint32]uint32{}
+			}
+			if order.Uint32(req[12:]) == 0 {
+				delete(s.xfixes[c], sel)
+			} else {
+				s.xfixes[c][sel] = w
+			}
+		default:
+			c.error(BadRequest, req[0], 0)
+		}
+	default:
+		c.error(BadRequest, req[0], 0)
+	}
+}
@@ -0,0 +1,94 @@
+package x11
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoXFixes is returned by XFixes when the server lacks the extension.
+var ErrNoXFixes = errors.New("x11: XFixes extension not available")
+
+// XFixesSelectSelectionInput masks.
+const (
+	XFixesSetSelectionOwnerNotifyMask      = 1 << 0
+	XFixesSelectionWindowDestroyNotifyMask = 1 << 1
+	XFixesSelectionClientCloseNotifyMask   = 1 << 2
+)
+
+// XFixesSelectionNotifyEvent subtypes.
+const (
+	XFixesSetSelectionOwnerNotify      = 0
+	XFixesSelectionWindowDestroyNotify = 1
+	XFixesSelectionClientCloseNotify   = 2
+)
+
+// XFixesSelectionNotifyEvent is sent when the owner of a selection
+// selected with XFixesSelectSelectionInput changes. Owner is None when
+// the selection was lost with the window or client of its owner.
+type XFixesSelectionNotifyEvent struct {
+	Subtype            uint8
+	Window             uint32
+	Owner              uint32
+	Selection          uint32
+	Time               uint32
+	SelectionTimestamp uint32
+}
+
+// XFixes is the XFixes extension of a connection.
+type XFixes struct {
+	c     *Conn
+	major uint8
+}
+
+// XFixes initializes the XFixes extension, which must be done before
+// its requests are used. Its events are returned by WaitEvent from then
+// on.
+func (c *Conn) XFixes() (*XFixes, error) {
+	present, major, first_event, err := c.QueryExtension("XFIXES")
+	if err != nil {
+		return nil, err
+	}
+	if !present {
+		return nil, ErrNoXFixes
+	}
+	// QueryVersion, selection tracking exists since version 1.
+	req := new_request(major, 0, 12)
+	order.PutUint32(req[4:], 5)
+	order.PutUint32(req[8:], 0)
+	r, err := c.request(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(r) < 16 {
+		return nil, errors.New("x11: short XFixes QueryVersion reply")
+	}
+	if version := order.Uint32(r[8:]); version < 1 {
+		return nil, fmt.Errorf("%w: version %d", ErrNoXFixes, version)
+	}
+	c.pmu.Lock()
+	c.xfixes_event = first_event
+	c.pmu.Unlock()
+	return &XFixes{c: c, major: major}, nil
+}
+
+// SelectSelectionInput asks for an XFixesSelectionNotifyEvent on window
+// whenever selection changes as selected by mask. It waits for the
+// server to process the request, returning the error it caused.
+func (x *XFixes) SelectSelectionInput(window uint32, selection uint32, mask uint32) error {
+	req := new_request(x.major, 2, 16)
+	order.PutUint32(req[4:], window)
+	order.PutUint32(req[8:], selection)
+	order.PutUint32(req[12:], mask)
+	return x.c.checked(req)
+}
+
+func parse_xfixes_event(buf []byte) Event {
+	return &XFixesSelectionNotifyEvent{
+		Subtype:            buf[1],
+		Window:             order.Uint32(buf[4:]),
+		Owner:              order.Uint32(buf[8:]),
+		Selection:          order.Uint32(buf[12:]),
+		Time:               order.Uint32(buf[16:]),
+		SelectionTimestamp: order.Uint32(buf[20:]),
+	}
+}
@@ -0,0 +1,79 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// RetryPolicy tells how long and how often an operation is retried while
+// the clipboard is busy, see ErrBusy. On Windows for example only one
+// application at a time may open the clipboard.
+type RetryPolicy struct {
+	// Timeout is how long the operation is retried before ErrBusy is
+	// returned, zero means it is tried only once. The deadline of the
+	// context passed to the operation, if earlier, takes precedence.
+	Timeout time.Duration
+	// Delay is the wait before the first retry, it doubles after every
+	// further attempt up to MaxDelay. It is at least a millisecond.
+	Delay    time.Duration
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by every Clipboard without a policy set
+// with SetRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	Timeout:  5 * time.Second,
+	Delay:    10 * time.Millisecond,
+	MaxDelay: 200 * time.Millisecond,
+}
+
+// context_backend is implemented by backends whose operations wait for
+// other applications, with_context returns the backend giving up once
+// ctx is done.
+type context_backend interface {
+	with_context(ctx context.Context) Backend
+}
+
+// do calls f until it succeeds or fails for another reason than a busy
+// clipboard, or until the policy or ctx tell to give up. Retries are
+// logged to l.
+func (p RetryPolicy) do(ctx context.Context, l *slog.Logger, f func() error) error {
+	deadline := time.Now().Add(p.Timeout)
+	delay := max(p.Delay, time.Millisecond)
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil {
+			return ctx_error(ctx)
+		}
+		err := f()
+		if !errors.Is(err, ErrBusy) || time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		l.LogAttrs(ctx, slog.LevelDebug, "clipboard busy, retrying",
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.Any("error", err),
+		)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx_error(ctx)
+		case <-t.C:
+		}
+		delay *= 2
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+}
+
+// ctx_error is the error of an operation stopped because ctx is done.
+// Running out of time means the clipboard was busy all along.
+func ctx_error(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return wrap(ErrBusy, ctx.Err())
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,84 @@
+package clipboard
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Selection names one of the clipboards of the display server. Only
+// Linux has selections besides SelectionClipboard: X11 has all three,
+// Wayland compositors have CLIPBOARD and usually PRIMARY.
+type Selection int
+
+const (
+	// SelectionClipboard is the clipboard used by copy and paste.
+	SelectionClipboard Selection = iota
+	// SelectionPrimary holds the last selected text, pasted with a
+	// middle click.
+	SelectionPrimary
+	// SelectionSecondary is the rarely used X11 SECONDARY selection.
+	SelectionSecondary
+)
+
+func (s Selection) String() string {
+	switch s {
+	case SelectionClipboard:
+		return "CLIPBOARD"
+	case SelectionPrimary:
+		return "PRIMARY"
+	case SelectionSecondary:
+		return "SECONDARY"
+	}
+	return fmt.Sprintf("Selection(%d)", int(s))
+}
+
+// NewSelection returns a Clipboard for selection s of the system
+// clipboard, configured by opts. It fails if the system has no such
+// selection.
+func NewSelection(s Selection, opts ...Option) (*Clipboard, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+	b, err := native_selection(s)
+	if err != nil {
+		return nil, err
+	}
+	c := New(b, opts...)
+	c.selection = s
+	return c, nil
+}
+
+// WatchSelections is like Watch for several selections at once, the
+// Selection field of the received content tells which one changed.
+func WatchSelections(ctx context.Context, selections ...Selection) (<-chan ClipboardContent, error) {
+	var boards []*Clipboard
+	for _, s := range selections {
+		c, err := NewSelection(s)
+		if err != nil {
+			return nil, err
+		}
+		boards = append(boards, c)
+	}
+	recv := make(chan ClipboardContent, 1)
+	var wg sync.WaitGroup
+	for _, c := range boards {
+		wg.Add(1)
+		go func(ch <-chan ClipboardContent) {
+			defer wg.Done()
+			for content := range ch {
+				// Nobody may receive anymore once ctx is done.
+				select {
+				case recv <- content:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(c.Watch(ctx))
+	}
+	go func() {
+		wg.Wait()
+		close(recv)
+	}()
+	return recv, nil
+}
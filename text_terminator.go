@@ -0,0 +1,58 @@
+package clipboard
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/ltaoo/clipboard-go/pkg/format"
+)
+
+// Windows keeps text in global memory without its length, the readers
+// stop at a NUL terminator. The allocation may be larger than the data.
+
+// text_terminator returns the terminator of the Windows clipboard format
+// called name, nil for binary formats. Text formats are the predefined
+// text formats and those of a text/ MIME type.
+func text_terminator(name string) []byte {
+	switch name {
+	case "CF_UNICODETEXT":
+		return []byte{0, 0}
+	case "CF_TEXT", "CF_OEMTEXT", "CF_DSPTEXT":
+		return []byte{0}
+	}
+	if strings.HasPrefix(name, "CF_") {
+		return nil
+	}
+	if strings.HasPrefix(format.Canonical(name), "text/") {
+		return []byte{0}
+	}
+	return nil
+}
+
+// nul_terminated appends the terminator of the format called name to
+// data unless it ends with one already.
+func nul_terminated(name string, data []byte) []byte {
+	t := text_terminator(name)
+	if t == nil || len(data)%len(t) == 0 && bytes.HasSuffix(data, t) {
+		return data
+	}
+	out := make([]byte, len(data), len(data)+2*len(t))
+	copy(out, data)
+	for len(out)%len(t) != 0 {
+		// UTF-16 text ends on a whole character.
+		out = append(out, 0)
+	}
+	return append(out, t...)
+}
+
+// trim_terminator cuts the data read as the format called name at its
+// terminator.
+func trim_terminator(name string, data []byte) []byte {
+	t := text_terminator(name)
+	for i := 0; t != nil && i+len(t) <= len(data); i += len(t) {
+		if bytes.Equal(data[i:i+len(t)], t) {
+			return data[:i]
+		}
+	}
+	return data
+}
@@ -0,0 +1,51 @@
+package clipboard
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNulTerminated(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		data, want []byte
+	}{
+		{"UniformResourceLocator", []byte("https://a"), []byte("https://a\x00")},
+		{"UniformResourceLocator", []byte("https://a\x00"), []byte("https://a\x00")},
+		{"Rich Text Format", []byte(`{\rtf1}`), []byte("{\\rtf1}\x00")},
+		{"text/x-myapp", nil, []byte{0}},
+		{"CF_TEXT", []byte("a"), []byte("a\x00")},
+		{"CF_UNICODETEXT", []byte{'a', 0}, []byte{'a', 0, 0, 0}},
+		{"CF_UNICODETEXT", []byte{'a', 0, 0, 0}, []byte{'a', 0, 0, 0}},
+		{"CF_UNICODETEXT", []byte{'a', 0, 'b'}, []byte{'a', 0, 'b', 0, 0, 0}},
+		{"CF_HDROP", []byte{1, 2}, []byte{1, 2}},
+		{"MyApp State", []byte{1, 2}, []byte{1, 2}},
+	} {
+		if got := nul_terminated(c.name, c.data); !bytes.Equal(got, c.want) {
+			t.Errorf("nul_terminated(%q, %q) = %q, want %q", c.name, c.data, got, c.want)
+		}
+	}
+	// The caller's slice is left alone.
+	data := []byte("ax")[:1]
+	nul_terminated("CF_TEXT", data)
+	if data[:2][1] != 'x' {
+		t.Error("nul_terminated wrote into the spare capacity")
+	}
+}
+
+func TestTrimTerminator(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		data, want []byte
+	}{
+		{"UniformResourceLocator", []byte("https://a\x00\x00junk"), []byte("https://a")},
+		{"Rich Text Format", []byte(`{\rtf1}`), []byte(`{\rtf1}`)},
+		{"CF_UNICODETEXT", []byte{'a', 0, 0, 0, 'x', 'y'}, []byte{'a', 0}},
+		{"CF_UNICODETEXT", []byte{0, 'a', 0, 0}, []byte{0, 'a'}},
+		{"MyApp State", []byte{1, 0, 2}, []byte{1, 0, 2}},
+	} {
+		if got := trim_terminator(c.name, c.data); !bytes.Equal(got, c.want) {
+			t.Errorf("trim_terminator(%q, %q) = %q, want %q", c.name, c.data, got, c.want)
+		}
+	}
+}
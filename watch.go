@@ -0,0 +1,472 @@
+package clipboard
+
+import (
+	"context"
+	"crypto/sha256"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ltaoo/clipboard-go/pkg/format"
+)
+
+// Every backend and selection is watched by a single hub, however many
+// subscribers there are. The hub notices changes, creates one Event for
+// all of them, so that data read through it is read once, and delivers
+// it according to the policy of each subscriber.
+
+// Policy decides what happens to events a subscriber is too slow to
+// receive.
+type Policy int
+
+const (
+	// PolicyCoalesce keeps only the latest undelivered event.
+	PolicyCoalesce Policy = iota
+	// PolicyBlock waits for the subscriber, delaying every other
+	// subscriber of the clipboard meanwhile.
+	PolicyBlock
+	// PolicyDropOldest discards the oldest buffered event to make room.
+	PolicyDropOldest
+	// PolicyDropNewest discards the new event when the buffer is full.
+	PolicyDropNewest
+)
+
+// WatchOptions configures WatchWithOptions, the zero value reports every
+// change.
+type WatchOptions struct {
+	// Interval is how often backends without change notification are
+	// polled, one second if zero. A clipboard watched by several
+	// subscribers is polled at the shortest of their intervals.
+	Interval time.Duration
+	// Formats restricts the events to content available as one of
+	// these types.
+	Formats []string
+	// Debounce delays events until the content has not changed for
+	// that long, so that only the last of rapid successive changes is
+	// reported.
+	Debounce time.Duration
+	// Initial sends an event for the current content right away.
+	Initial bool
+	// Policy handles events the subscriber is too slow for.
+	Policy Policy
+	// Buffer is the number of events buffered for the subscriber, at
+	// least one. PolicyCoalesce always buffers one.
+	Buffer int
+	// SkipOwn leaves out the changes made by writes through the watched
+	// Clipboard, SkipProcess those made through any Clipboard of this
+	// process, see Event.Writer.
+	SkipOwn     bool
+	SkipProcess bool
+	// Dedup drops events whose content equals that of the last event
+	// delivered, nil reports every change.
+	Dedup *Dedup
+}
+
+// Dedup configures the deduplication of WatchOptions. The content of
+// every event is read and hashed for it.
+type Dedup struct {
+	// Window is how long the content of a delivered event suppresses
+	// the same content, forever if zero.
+	Window time.Duration
+	// Formats are the types whose data is compared, every type of the
+	// content if empty. Events with none of them are always delivered.
+	Formats []string
+}
+
+// WatchStats counts the events of a Subscription.
+type WatchStats struct {
+	Delivered uint64
+	Dropped   uint64
+}
+
+// Subscription receives the events of a clipboard on C, which is closed
+// once the context given to Subscribe is canceled.
+type Subscription struct {
+	C <-chan *Event
+
+	c             chan *Event
+	owner         *Clipboard
+	ctx           context.Context
+	opts          WatchOptions
+	formats       []string
+	dedup_formats []string
+
+	mu     sync.Mutex // held while sending on c
+	closed bool
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+
+	// Owned by the hub.
+	initial   bool
+	pending   *Event
+	due       time.Time
+	last_sum  [sha256.Size]byte
+	last_time time.Time
+}
+
+// Stats returns how many events were delivered to and dropped for s.
+func (s *Subscription) Stats() WatchStats {
+	return WatchStats{Delivered: s.delivered.Load(), Dropped: s.dropped.Load()}
+}
+
+func (s *Subscription) matches(e *Event) bool {
+	if e.Writer != nil && (s.opts.SkipProcess || s.opts.SkipOwn && e.Writer == s.owner) {
+		return false
+	}
+	return len(s.formats) == 0 || e.has_any(s.formats)
+}
+
+// wants reports whether e is delivered to s, called by the hub only.
+func (s *Subscription) wants(e *Event) bool {
+	if !s.matches(e) {
+		return false
+	}
+	d := s.opts.Dedup
+	if d == nil {
+		return true
+	}
+	sum, ok, err := e.digest(s.dedup_formats)
+	if err != nil || !ok {
+		return true
+	}
+	if !s.last_time.IsZero() && sum == s.last_sum && (d.Window <= 0 || e.Time.Sub(s.last_time) < d.Window) {
+		return false
+	}
+	s.last_sum, s.last_time = sum, e.Time
+	return true
+}
+
+func (s *Subscription) deliver(e *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	switch s.opts.Policy {
+	case PolicyBlock:
+		select {
+		case s.c <- e:
+			s.delivered.Add(1)
+		case <-s.ctx.Done():
+			s.dropped.Add(1)
+		}
+		return
+	case PolicyDropNewest:
+		select {
+		case s.c <- e:
+			s.delivered.Add(1)
+		default:
+			s.dropped.Add(1)
+		}
+		return
+	}
+	// PolicyCoalesce and PolicyDropOldest make room for e.
+	for {
+		select {
+		case s.c <- e:
+			s.delivered.Add(1)
+			return
+		default:
+		}
+		select {
+		case <-s.c:
+			s.delivered.Add(^uint64(0))
+			s.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	close(s.c)
+}
+
+// Subscribe starts watching c as configured by opts.
+func (c *Clipboard) Subscribe(ctx context.Context, opts WatchOptions) *Subscription {
+	size := opts.Buffer
+	if size < 1 || opts.Policy == PolicyCoalesce {
+		size = 1
+	}
+	s := &Subscription{
+		c:       make(chan *Event, size),
+		owner:   c,
+		ctx:     ctx,
+		opts:    opts,
+		initial: opts.Initial,
+	}
+	s.C = s.c
+	for _, f := range opts.Formats {
+		s.formats = append(s.formats, format.Canonical(f))
+	}
+	if opts.Dedup != nil {
+		for _, f := range opts.Dedup.Formats {
+			s.dedup_formats = append(s.dedup_formats, format.Canonical(f))
+		}
+	}
+	h := join_hub(c.Backend(), c.selection, s)
+	go func() {
+		<-ctx.Done()
+		h.leave(s)
+	}()
+	return s
+}
+
+// WatchWithOptions is like Events, configured by opts.
+func (c *Clipboard) WatchWithOptions(ctx context.Context, opts WatchOptions) <-chan *Event {
+	return c.Subscribe(ctx, opts).C
+}
+
+// Events returns a channel receiving an Event after every change of c,
+// it is closed once ctx is canceled. Backends without change
+// notification are polled every second.
+func (c *Clipboard) Events(ctx context.Context) <-chan *Event {
+	return c.WatchWithOptions(ctx, WatchOptions{})
+}
+
+// Subscribe starts watching the clipboard as configured by opts.
+func Subscribe(ctx context.Context, opts WatchOptions) *Subscription {
+	return std.Subscribe(ctx, opts)
+}
+
+// WatchWithOptions is like Events, configured by opts.
+func WatchWithOptions(ctx context.Context, opts WatchOptions) <-chan *Event {
+	return std.WatchWithOptions(ctx, opts)
+}
+
+type hub_key struct {
+	backend   Backend
+	selection Selection
+}
+
+var (
+	hubs_mu sync.Mutex
+	hubs    = map[hub_key]*hub{}
+)
+
+type hub struct {
+	key     hub_key
+	backend Backend
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	wake        chan struct{}
+	stop        chan struct{}
+	// A backend which cannot be a map key gets a hub of its own.
+	shared bool
+}
+
+// Writes through a Clipboard record the change count they lead to, so
+// that the events of the own changes can name their writer.
+type write_record struct {
+	count  uint64
+	writer *Clipboard
+}
+
+// writes holds the last write to every backend and selection, guarded by
+// hubs_mu. Backends which cannot be map keys are not recorded.
+var writes = map[hub_key]write_record{}
+
+func (c *Clipboard) wrote(b Backend, err error) (*Ownership, error) {
+	if err != nil {
+		return nil, err
+	}
+	count := b.ChangeCount()
+	if reflect.TypeOf(b).Comparable() {
+		hubs_mu.Lock()
+		writes[hub_key{backend: b, selection: c.selection}] = write_record{count: count, writer: c}
+		hubs_mu.Unlock()
+	}
+	return new_ownership(b, count), nil
+}
+
+// writer returns the Clipboard whose write led to change count count.
+func (h *hub) writer(count uint64) *Clipboard {
+	if !h.shared {
+		return nil
+	}
+	hubs_mu.Lock()
+	defer hubs_mu.Unlock()
+	if w, ok := writes[h.key]; ok && w.count == count {
+		return w.writer
+	}
+	return nil
+}
+
+func join_hub(b Backend, sel Selection, s *Subscription) *hub {
+	hubs_mu.Lock()
+	defer hubs_mu.Unlock()
+	key := hub_key{backend: b, selection: sel}
+	shared := reflect.TypeOf(b).Comparable()
+	var h *hub
+	if shared {
+		h = hubs[key]
+	}
+	if h == nil {
+		h = &hub{
+			key:         key,
+			backend:     b,
+			subscribers: map[*Subscription]struct{}{},
+			wake:        make(chan struct{}, 1),
+			stop:        make(chan struct{}),
+			shared:      shared,
+		}
+		if shared {
+			hubs[key] = h
+		}
+		go h.run(b.ChangeCount())
+	}
+	h.mu.Lock()
+	h.subscribers[s] = struct{}{}
+	h.mu.Unlock()
+	h.poke()
+	return h
+}
+
+func (h *hub) leave(s *Subscription) {
+	hubs_mu.Lock()
+	h.mu.Lock()
+	delete(h.subscribers, s)
+	if len(h.subscribers) == 0 {
+		if h.shared {
+			delete(hubs, h.key)
+		}
+		close(h.stop)
+	}
+	h.mu.Unlock()
+	hubs_mu.Unlock()
+	s.close()
+	h.poke()
+}
+
+func (h *hub) poke() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// state returns the subscribers, the shortest polling interval and the
+// time the next debounced event is due.
+func (h *hub) state() ([]*Subscription, time.Duration, time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var subs []*Subscription
+	interval := time.Duration(0)
+	var due time.Time
+	for s := range h.subscribers {
+		subs = append(subs, s)
+		i := s.opts.Interval
+		if i <= 0 {
+			i = time.Second
+		}
+		if interval == 0 || i < interval {
+			interval = i
+		}
+		if s.pending != nil && (due.IsZero() || s.due.Before(due)) {
+			due = s.due
+		}
+	}
+	return subs, interval, due
+}
+
+func (h *hub) run(prev_count uint64) {
+	b := h.backend
+	changed, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	var ti *time.Ticker
+	var tick <-chan time.Time
+	var poll_interval time.Duration
+	// Fires when the earliest debounced event is due. Since Go 1.23
+	// Reset drops a value not received yet.
+	settle := time.NewTimer(time.Hour)
+	settle.Stop()
+	defer func() {
+		if ti != nil {
+			ti.Stop()
+		}
+		settle.Stop()
+	}()
+	for {
+		subs, interval, due := h.state()
+		if changed == nil && interval > 0 && interval != poll_interval {
+			// Backends without notification are polled.
+			if ti != nil {
+				ti.Stop()
+			}
+			ti = time.NewTicker(interval)
+			tick = ti.C
+			poll_interval = interval
+		}
+		var settled <-chan time.Time
+		if !due.IsZero() {
+			settle.Reset(time.Until(due))
+			settled = settle.C
+		}
+		select {
+		case <-h.stop:
+			return
+		case <-changed:
+		case <-tick:
+		case <-settled:
+		case <-h.wake:
+		}
+		// Subscribers may have joined while waiting, their initial
+		// events are due now.
+		subs, _, _ = h.state()
+		h.mu.Lock()
+		var initial []*Subscription
+		for _, s := range subs {
+			if s.initial {
+				s.initial = false
+				initial = append(initial, s)
+			}
+		}
+		h.mu.Unlock()
+		if len(initial) > 0 {
+			e := new_event(b, prev_count, h.key.selection)
+			e.Writer = h.writer(prev_count)
+			for _, s := range initial {
+				if s.wants(e) {
+					s.deliver(e)
+				}
+			}
+		}
+		if cur_count := b.ChangeCount(); cur_count != prev_count {
+			prev_count = cur_count
+			e := new_event(b, cur_count, h.key.selection)
+			e.Writer = h.writer(cur_count)
+			for _, s := range subs {
+				if s.opts.Debounce > 0 {
+					// Changes the subscriber filters out neither
+					// replace nor postpone the one it waits for.
+					if s.matches(e) {
+						h.mu.Lock()
+						s.pending, s.due = e, time.Now().Add(s.opts.Debounce)
+						h.mu.Unlock()
+					}
+				} else if s.wants(e) {
+					s.deliver(e)
+				}
+			}
+		}
+		now := time.Now()
+		for _, s := range subs {
+			h.mu.Lock()
+			e := s.pending
+			if e == nil || s.due.After(now) {
+				h.mu.Unlock()
+				continue
+			}
+			s.pending = nil
+			h.mu.Unlock()
+			if s.wants(e) {
+				s.deliver(e)
+			}
+		}
+	}
+}
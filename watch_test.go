@@ -0,0 +1,326 @@
+package clipboard_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ltaoo/clipboard-go"
+	"github.com/ltaoo/clipboard-go/clipboardtest"
+)
+
+func TestWatchInitialOnRunningHub(t *testing.T) {
+	fake := clipboardtest.New()
+	fake.Set(clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte("hello")})
+	c := clipboard.New(fake)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := c.WatchWithOptions(ctx, clipboard.WatchOptions{Initial: true})
+	select {
+	case <-first:
+	case <-time.After(time.Second):
+		t.Fatal("no initial event for the first subscriber")
+	}
+	second := c.WatchWithOptions(ctx, clipboard.WatchOptions{Initial: true})
+	select {
+	case e := <-second:
+		if text, err := e.Text(); err != nil || text != "hello" {
+			t.Fatalf("initial event = %q, %v", text, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no initial event for a subscriber joining a running hub")
+	}
+}
+
+// gdi_backend fails to read CF_ENHMETAFILE, like the GDI handles Office
+// puts on the Windows clipboard.
+type gdi_backend struct {
+	*clipboardtest.Backend
+}
+
+func (b gdi_backend) ReadFormat(name string) ([]byte, error) {
+	if name == "CF_ENHMETAFILE" {
+		return nil, errors.New("GlobalLock failed")
+	}
+	return b.Backend.ReadFormat(name)
+}
+
+func TestWatchDedupSkipsUnreadableFormats(t *testing.T) {
+	fake := gdi_backend{clipboardtest.New()}
+	c := clipboard.New(fake)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := c.WatchWithOptions(ctx, clipboard.WatchOptions{
+		Interval: 5 * time.Millisecond,
+		Dedup:    &clipboard.Dedup{},
+		Buffer:   4,
+		Policy:   clipboard.PolicyDropNewest,
+	})
+	publish := func(text string) {
+		fake.Set(
+			clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte(text)},
+			clipboardtest.Item{Type: "CF_ENHMETAFILE", Data: []byte("handle")},
+		)
+	}
+	next := func() *clipboard.Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(200 * time.Millisecond):
+			return nil
+		}
+	}
+
+	publish("hello")
+	if next() == nil {
+		t.Fatal("no event for the first content")
+	}
+	// Office publishes the same content again.
+	publish("hello")
+	if e := next(); e != nil {
+		t.Fatalf("duplicate content delivered, seq %d", e.Seq)
+	}
+	publish("world")
+	if next() == nil {
+		t.Fatal("no event for new content")
+	}
+}
+
+func TestWatchDebounceFiltersFirst(t *testing.T) {
+	fake := clipboardtest.New()
+	c := clipboard.New(fake)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := c.WatchWithOptions(ctx, clipboard.WatchOptions{
+		Formats:  []string{clipboard.TypePNG},
+		Debounce: 30 * time.Millisecond,
+	})
+	fake.Set(clipboardtest.Item{Type: clipboardtest.TypePNG, Data: []byte("png")})
+	seq := fake.ChangeCount()
+	time.Sleep(10 * time.Millisecond)
+	// Text the subscriber does not want must not replace the image.
+	fake.Set(clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte("text")})
+	select {
+	case e := <-events:
+		if e.Seq != seq {
+			t.Errorf("event seq = %d, want %d", e.Seq, seq)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the image change was lost")
+	}
+}
+
+// settle waits until the hub handled n changes for s.
+func settle(t *testing.T, s *clipboard.Subscription, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		st := s.Stats()
+		if st.Delivered+st.Dropped >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v, want %d events handled", st, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// received drains the events buffered for s.
+func received(s *clipboard.Subscription) []uint64 {
+	var seqs []uint64
+	for {
+		select {
+		case e := <-s.C:
+			seqs = append(seqs, e.Seq)
+		default:
+			return seqs
+		}
+	}
+}
+
+func TestWatchPolicies(t *testing.T) {
+	for _, c := range []struct {
+		policy clipboard.Policy
+		seqs   []uint64
+		stats  clipboard.WatchStats
+	}{
+		{clipboard.PolicyDropNewest, []uint64{1, 2}, clipboard.WatchStats{Delivered: 2, Dropped: 2}},
+		// Evicted events no longer count as delivered.
+		{clipboard.PolicyDropOldest, []uint64{3, 4}, clipboard.WatchStats{Delivered: 2, Dropped: 2}},
+		// Coalesce buffers one event whatever Buffer says.
+		{clipboard.PolicyCoalesce, []uint64{4}, clipboard.WatchStats{Delivered: 1, Dropped: 3}},
+	} {
+		fake := clipboardtest.New()
+		ctx, cancel := context.WithCancel(context.Background())
+		s := clipboard.New(fake).Subscribe(ctx, clipboard.WatchOptions{Policy: c.policy, Buffer: 2})
+		for i := range uint64(4) {
+			fake.Set(clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte{'a' + byte(i)}})
+			settle(t, s, i+1)
+		}
+		if seqs := received(s); !slices.Equal(seqs, c.seqs) {
+			t.Errorf("policy %v: received %v, want %v", c.policy, seqs, c.seqs)
+		}
+		if st := s.Stats(); st != c.stats {
+			t.Errorf("policy %v: stats = %+v, want %+v", c.policy, st, c.stats)
+		}
+		cancel()
+	}
+}
+
+func TestWatchPolicyBlock(t *testing.T) {
+	fake := clipboardtest.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := clipboard.New(fake).Subscribe(ctx, clipboard.WatchOptions{Policy: clipboard.PolicyBlock, Buffer: 2})
+	set := func(text string) {
+		fake.Set(clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte(text)})
+	}
+	next := func() uint64 {
+		t.Helper()
+		select {
+		case e := <-s.C:
+			return e.Seq
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+		}
+		return 0
+	}
+	set("a")
+	settle(t, s, 1)
+	set("b")
+	settle(t, s, 2)
+	// The buffer is full, the hub waits for the subscriber.
+	set("c")
+	time.Sleep(20 * time.Millisecond)
+	if st := s.Stats(); st.Delivered != 2 {
+		t.Errorf("stats = %+v while blocked, want 2 delivered", st)
+	}
+	seqs := []uint64{next()}
+	settle(t, s, 3)
+	set("d")
+	seqs = append(seqs, next(), next())
+	settle(t, s, 4)
+	seqs = append(seqs, next())
+	if want := []uint64{1, 2, 3, 4}; !slices.Equal(seqs, want) {
+		t.Errorf("received %v, want %v", seqs, want)
+	}
+	if st := s.Stats(); st != (clipboard.WatchStats{Delivered: 4}) {
+		t.Errorf("stats = %+v, want 4 delivered", st)
+	}
+}
+
+// until receives the events of s up to the one of change seq.
+func until(t *testing.T, s *clipboard.Subscription, seq uint64) []*clipboard.Event {
+	t.Helper()
+	var events []*clipboard.Event
+	for {
+		select {
+		case e := <-s.C:
+			events = append(events, e)
+			if e.Seq >= seq {
+				return events
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event for change %d, got %d events", seq, len(events))
+		}
+	}
+}
+
+func TestWatchSkipWriters(t *testing.T) {
+	fake := clipboardtest.New()
+	own, other := clipboard.New(fake), clipboard.New(fake)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := clipboard.WatchOptions{Policy: clipboard.PolicyDropNewest, Buffer: 8}
+	all := own.Subscribe(ctx, opts)
+	opts.SkipOwn = true
+	skip_own := own.Subscribe(ctx, opts)
+	opts.SkipOwn, opts.SkipProcess = false, true
+	skip_process := own.Subscribe(ctx, opts)
+
+	// One change at a time, rapid ones would be reported together.
+	if err := own.WriteText("own"); err != nil {
+		t.Fatal(err)
+	}
+	settle(t, all, 1)
+	if err := other.WriteText("other"); err != nil {
+		t.Fatal(err)
+	}
+	settle(t, all, 2)
+	fake.Set(clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte("foreign")})
+	settle(t, all, 3)
+
+	writers := func(events []*clipboard.Event) []*clipboard.Clipboard {
+		var w []*clipboard.Clipboard
+		for _, e := range events {
+			w = append(w, e.Writer)
+		}
+		return w
+	}
+	for _, c := range []struct {
+		name string
+		s    *clipboard.Subscription
+		want []*clipboard.Clipboard
+	}{
+		{"all", all, []*clipboard.Clipboard{own, other, nil}},
+		{"SkipOwn", skip_own, []*clipboard.Clipboard{other, nil}},
+		{"SkipProcess", skip_process, []*clipboard.Clipboard{nil}},
+	} {
+		if got := writers(until(t, c.s, 3)); !slices.Equal(got, c.want) {
+			t.Errorf("%v: writers %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWatchDedup(t *testing.T) {
+	fake := clipboardtest.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := clipboard.WatchOptions{Policy: clipboard.PolicyDropNewest, Buffer: 8}
+	all := clipboard.New(fake).Subscribe(ctx, opts)
+	opts.Dedup = &clipboard.Dedup{}
+	forever := clipboard.New(fake).Subscribe(ctx, opts)
+	opts.Dedup = &clipboard.Dedup{Window: 100 * time.Millisecond}
+	window := clipboard.New(fake).Subscribe(ctx, opts)
+	opts.Dedup = &clipboard.Dedup{Formats: []string{clipboard.TypeText}}
+	text := clipboard.New(fake).Subscribe(ctx, opts)
+
+	set := func(n uint64, text, html string) {
+		fake.Set(
+			clipboardtest.Item{Type: clipboardtest.TypeText, Data: []byte(text)},
+			clipboardtest.Item{Type: clipboardtest.TypeHTML, Data: []byte(html)},
+		)
+		settle(t, all, n)
+	}
+	set(1, "a", "<b>a</b>")
+	set(2, "a", "<b>a</b>") // the same content again
+	time.Sleep(150 * time.Millisecond)
+	set(3, "a", "<b>a</b>") // again, after the window
+	set(4, "a", "<i>a</i>") // the same text only
+	set(5, "b", "<i>b</i>")
+
+	seqs := func(events []*clipboard.Event) []uint64 {
+		var seqs []uint64
+		for _, e := range events {
+			seqs = append(seqs, e.Seq)
+		}
+		return seqs
+	}
+	for _, c := range []struct {
+		name string
+		s    *clipboard.Subscription
+		want []uint64
+	}{
+		{"forever", forever, []uint64{1, 4, 5}},
+		{"window", window, []uint64{1, 3, 4, 5}},
+		{"text", text, []uint64{1, 5}},
+	} {
+		if got := seqs(until(t, c.s, 5)); !slices.Equal(got, c.want) {
+			t.Errorf("%v: received %v, want %v", c.name, got, c.want)
+		}
+	}
+}